@@ -0,0 +1,257 @@
+package main
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/linkedin/goavro/v2"
+)
+
+const (
+	avroMagicByteLen = 1
+	avroSchemaIDLen  = 4
+)
+
+// AvroSRDecoder decodes Avro-encoded Debezium events produced with a
+// Confluent Schema Registry serializer: a 1-byte magic (always 0x0), a
+// 4-byte big-endian schema ID, then the Avro binary payload. Schemas are
+// fetched from SCHEMA_REGISTRY_URL on first use and cached by ID.
+type AvroSRDecoder struct {
+	registryURL string
+	username    string
+	password    string
+	httpClient  *http.Client
+	cache       *schemaCache
+}
+
+// NewAvroSRDecoder builds an AvroSRDecoder from cfg. Basic auth is applied
+// to schema registry requests when SchemaRegistryUser is set.
+func NewAvroSRDecoder(cfg DecoderConfig) *AvroSRDecoder {
+	cacheSize := cfg.SchemaCacheSize
+	if cacheSize <= 0 {
+		cacheSize = 100
+	}
+
+	return &AvroSRDecoder{
+		registryURL: strings.TrimRight(cfg.SchemaRegistryURL, "/"),
+		username:    cfg.SchemaRegistryUser,
+		password:    cfg.SchemaRegistryPass,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		cache:       newSchemaCache(cacheSize),
+	}
+}
+
+func (d *AvroSRDecoder) Decode(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+	if len(msg.Value) < avroMagicByteLen+avroSchemaIDLen {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("avro message too short: %d bytes", len(msg.Value))}
+	}
+	if msg.Value[0] != 0x0 {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("unexpected avro magic byte: 0x%x", msg.Value[0])}
+	}
+
+	schemaID := binary.BigEndian.Uint32(msg.Value[avroMagicByteLen : avroMagicByteLen+avroSchemaIDLen])
+
+	// codecFor's error is not wrapped in a terminalError: it may be a transient schema
+	// registry network/HTTP error (retryable) as easily as a genuinely
+	// invalid schema (terminal), and classifyError tells those apart.
+	codec, err := d.codecFor(schemaID)
+	if err != nil {
+		return CDCEvent{}, fmt.Errorf("failed to resolve avro schema %d: %w", schemaID, err)
+	}
+
+	native, _, err := codec.NativeFromBinary(msg.Value[avroMagicByteLen+avroSchemaIDLen:])
+	if err != nil {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("failed to decode avro payload for schema %d: %w", schemaID, err)}
+	}
+
+	event, err := cdcEventFromAvroNative(native)
+	if err != nil {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: err}
+	}
+	return event, nil
+}
+
+func (d *AvroSRDecoder) codecFor(schemaID uint32) (*goavro.Codec, error) {
+	if codec, ok := d.cache.get(schemaID); ok {
+		return codec, nil
+	}
+
+	schema, err := d.fetchSchema(schemaID)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, &terminalError{reason: "decode_error", err: fmt.Errorf("invalid avro schema: %w", err)}
+	}
+
+	d.cache.put(schemaID, codec)
+	return codec, nil
+}
+
+// fetchSchema's error is a plain network error (net.Error, retryable) when
+// the registry can't be reached at all, or an *httpStatusError when it
+// responds with a non-200, so classifyError can tell a registry outage
+// (retry) from a schema ID the registry genuinely doesn't know about (4xx,
+// terminal).
+func (d *AvroSRDecoder) fetchSchema(schemaID uint32) (string, error) {
+	url := fmt.Sprintf("%s/schemas/ids/%d", d.registryURL, schemaID)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if d.username != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &httpStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var out struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode schema registry response: %w", err)
+	}
+	return out.Schema, nil
+}
+
+// cdcEventFromAvroNative interprets goavro's decoded native value as a
+// Debezium envelope record, mirroring EnvelopeJSONDecoder but reading off
+// the generic map[string]interface{} goavro produces for Avro records.
+func cdcEventFromAvroNative(native interface{}) (CDCEvent, error) {
+	top, ok := native.(map[string]interface{})
+	if !ok {
+		return CDCEvent{}, fmt.Errorf("unexpected avro payload shape: %T", native)
+	}
+
+	// Some connector configurations nest the envelope under "payload", like
+	// their JSON counterpart.
+	if payload, ok := top["payload"].(map[string]interface{}); ok {
+		top = payload
+	}
+
+	before := avroUnionRecord(top["before"])
+	after := avroUnionRecord(top["after"])
+	source := avroUnionRecord(top["source"])
+
+	return CDCEvent{
+		Op:     StringField(top, "op"),
+		Table:  StringField(source, "table"),
+		Before: before,
+		After:  after,
+		Source: CDCSource{
+			TsMs: avroInt64Field(source, "ts_ms"),
+			LSN:  avroInt64Field(source, "lsn"),
+		},
+	}, nil
+}
+
+// avroUnionRecord unwraps a goavro-decoded Avro union value. A nullable
+// record field decodes as either nil, or a single-entry map keyed by the
+// chosen branch's full name (e.g. {"com.example.Value": {...}}).
+func avroUnionRecord(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if len(m) == 1 {
+		for _, inner := range m {
+			if innerMap, ok := inner.(map[string]interface{}); ok {
+				return innerMap
+			}
+		}
+	}
+	return m
+}
+
+func avroInt64Field(fields map[string]interface{}, key string) int64 {
+	if fields == nil {
+		return 0
+	}
+	switch v := fields[key].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// schemaCache is a small in-memory LRU cache keyed by Confluent schema ID,
+// so a hot topic doesn't hit the schema registry on every message.
+type schemaCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[uint32]*list.Element
+}
+
+type schemaCacheEntry struct {
+	id    uint32
+	codec *goavro.Codec
+}
+
+func newSchemaCache(capacity int) *schemaCache {
+	return &schemaCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[uint32]*list.Element),
+	}
+}
+
+func (c *schemaCache) get(id uint32) (*goavro.Codec, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[id]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*schemaCacheEntry).codec, true
+}
+
+func (c *schemaCache) put(id uint32, codec *goavro.Codec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[id]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*schemaCacheEntry).codec = codec
+		return
+	}
+
+	el := c.ll.PushFront(&schemaCacheEntry{id: id, codec: codec})
+	c.items[id] = el
+
+	if c.ll.Len() > c.capacity {
+		if oldest := c.ll.Back(); oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*schemaCacheEntry).id)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestAvroUnionRecord(t *testing.T) {
+	inner := map[string]interface{}{"id": "w1"}
+
+	tests := []struct {
+		name string
+		in   interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "nil union value",
+			in:   nil,
+			want: nil,
+		},
+		{
+			name: "non-map value",
+			in:   "not a record",
+			want: nil,
+		},
+		{
+			name: "single-entry union wraps the chosen branch",
+			in:   map[string]interface{}{"com.example.Value": inner},
+			want: inner,
+		},
+		{
+			name: "plain record with no union wrapper passes through",
+			in:   inner,
+			want: inner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := avroUnionRecord(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("avroUnionRecord(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("avroUnionRecord(%v)[%q] = %v, want %v", tt.in, k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestAvroInt64Field(t *testing.T) {
+	fields := map[string]interface{}{
+		"int64_val":   int64(42),
+		"int32_val":   int32(7),
+		"float64_val": float64(9),
+	}
+
+	if got := avroInt64Field(fields, "int64_val"); got != 42 {
+		t.Errorf("avroInt64Field(int64_val) = %d, want 42", got)
+	}
+	if got := avroInt64Field(fields, "int32_val"); got != 7 {
+		t.Errorf("avroInt64Field(int32_val) = %d, want 7", got)
+	}
+	if got := avroInt64Field(fields, "float64_val"); got != 9 {
+		t.Errorf("avroInt64Field(float64_val) = %d, want 9", got)
+	}
+	if got := avroInt64Field(fields, "missing"); got != 0 {
+		t.Errorf("avroInt64Field(missing) = %d, want 0", got)
+	}
+	if got := avroInt64Field(nil, "anything"); got != 0 {
+		t.Errorf("avroInt64Field(nil) = %d, want 0", got)
+	}
+}
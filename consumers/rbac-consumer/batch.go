@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	batchSizeHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "rbac_kafka_consumer_batch_size",
+			Help:    "Number of Kafka messages accumulated per relationship write batch",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+	batchWriteDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "rbac_kafka_consumer_batch_write_duration_seconds",
+			Help:    "Time to process and write one relationship batch, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(batchSizeHistogram)
+	prometheus.MustRegister(batchWriteDuration)
+}
+
+// BatchConfig controls how ConsumeClaim groups messages before issuing a
+// relationship write: up to Size messages, or whenever LingerMs elapses
+// since the first message of the in-progress batch, whichever comes first.
+type BatchConfig struct {
+	Size     int
+	LingerMs time.Duration
+}
+
+// relationshipOp is a single deduplicated relationship write derived from
+// one or more CDC events in a batch.
+type relationshipOp struct {
+	Operation    string `json:"operation"` // "touch" (create/update) or "delete"
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Relation     string `json:"relation"`
+	SubjectType  string `json:"subject_type"`
+	SubjectID    string `json:"subject_id"`
+}
+
+func (op relationshipOp) key() string {
+	return op.ResourceType + "|" + op.ResourceID + "|" + op.Relation + "|" + op.SubjectType + "|" + op.SubjectID
+}
+
+// dedupeRelationshipOps keeps only the last op seen per (resource_type,
+// resource_id, relation, subject_type, subject_id) tuple, so a batch that
+// touches the same tuple more than once (e.g. an update's delete-then-create,
+// or two CDC events for the same row) only issues the final write.
+func dedupeRelationshipOps(ops []relationshipOp) []relationshipOp {
+	index := make(map[string]int, len(ops))
+	deduped := make([]relationshipOp, 0, len(ops))
+	for _, op := range ops {
+		if i, ok := index[op.key()]; ok {
+			deduped[i] = op
+			continue
+		}
+		index[op.key()] = len(deduped)
+		deduped = append(deduped, op)
+	}
+	return deduped
+}
+
+// relationshipOpsForEvent builds the relationship writes implied by a single
+// CDC event. An update is treated as a delete of the old tuples followed by
+// a create of the new ones; dedupeRelationshipOps collapses that down to the
+// create when both land on the same tuple, matching how handleUpdate used to
+// work (delete then create) before batching.
+func relationshipOpsForEvent(event CDCEvent) []relationshipOp {
+	switch event.Op {
+	case "c", "r": // Create or Read (snapshot)
+		return relationshipOpsForTable("touch", event)
+	case "u": // Update
+		// The delete is built from Before when the decoder carries it
+		// (envelope/avro); flat messages only have After, so there the
+		// delete and the create target the same tuple.
+		old := event
+		if len(event.Before) > 0 {
+			old.After = nil
+		}
+		ops := relationshipOpsForTable("delete", old)
+		return append(ops, relationshipOpsForTable("touch", event)...)
+	case "d": // Delete
+		return relationshipOpsForTable("delete", event)
+	default:
+		log.Printf("Unknown operation: %s (skipping)", event.Op)
+		return nil
+	}
+}
+
+func relationshipOpsForTable(operation string, event CDCEvent) []relationshipOp {
+	row := event.Fields()
+	switch event.Table {
+	case "workspaces":
+		return workspaceRelationshipOps(operation, row)
+	case "roles":
+		return roleRelationshipOps(operation, row)
+	default:
+		log.Printf("Unhandled table: %s", event.Table)
+		return nil
+	}
+}
+
+// workspaceRelationshipOps builds the workspace -> parent tenant
+// relationship write for a workspace row:
+// rbac/workspace:workspace_id#t_parent@rbac/tenant:tenant_id
+func workspaceRelationshipOps(operation string, row map[string]interface{}) []relationshipOp {
+	id := StringField(row, "id")
+	if id == "" {
+		validationErrors.Inc()
+		log.Printf("WARNING: workspace id not found (skipping)")
+		return nil
+	}
+
+	tenantID := StringField(row, "tenant_id")
+	if tenantID == "" {
+		return nil
+	}
+
+	return []relationshipOp{{
+		Operation:    operation,
+		ResourceType: "rbac/workspace",
+		ResourceID:   id,
+		Relation:     "t_parent",
+		SubjectType:  "rbac/tenant",
+		SubjectID:    tenantID,
+	}}
+}
+
+// roleRelationshipOps would build role -> workspace_binding relationships,
+// but the production schema doesn't have a simple "role belongs to
+// workspace" relationship: roles are bound to resources via role_bindings,
+// which this event alone doesn't carry. Left as a no-op, same as before
+// batching.
+func roleRelationshipOps(operation string, row map[string]interface{}) []relationshipOp {
+	id := StringField(row, "id")
+	if id == "" {
+		validationErrors.Inc()
+		log.Printf("WARNING: role id not found (skipping)")
+		return nil
+	}
+	log.Printf("Note: Role relationships require role_binding context - skipping for now (role=%s)", id)
+	return nil
+}
+
+// batchWriteRequest is the body posted to /v1/relationships. relationshipOp's
+// JSON tags match RelationshipUpdateItem's on the Relations API side field
+// for field, so this marshals straight into the Updates array it expects.
+type batchWriteRequest struct {
+	Updates []relationshipOp `json:"updates"`
+}
+
+// decodeWithRetry decodes msg, classifying the error the same way
+// writeBatchWithRetry classifies write errors: a retryable error (e.g. a
+// schema registry network blip) gets retried with backoff, while a terminal
+// one (malformed payload, schema genuinely invalid) goes straight to the
+// DLQ. ok is false when the message was routed to the DLQ rather than
+// decoded; a non-nil error means ctx was cancelled mid-retry.
+func (h *ConsumerGroupHandler) decodeWithRetry(ctx context.Context, msg *sarama.ConsumerMessage) (event CDCEvent, ok bool, err error) {
+	attempt := 0
+	maxBackoff := 30 * time.Second
+	baseBackoff := 500 * time.Millisecond
+
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return CDCEvent{}, false, ctxErr
+		}
+
+		event, decodeErr := h.decoder.Decode(msg)
+		if decodeErr == nil {
+			return event, true, nil
+		}
+
+		terminal, reason := classifyError(decodeErr)
+		if !terminal {
+			attempt++
+			retryAttempts.Inc()
+			log.Printf("Error decoding CDC event from topic %s (attempt %d/%d, reason=%s): %v", msg.Topic, attempt, h.maxRetries, reason, decodeErr)
+
+			if h.maxRetries <= 0 || attempt < h.maxRetries {
+				backoff := time.Duration(math.Min(
+					float64(baseBackoff)*math.Pow(2, float64(attempt-1)),
+					float64(maxBackoff),
+				))
+				if waitErr := sleepOrDone(ctx, backoff); waitErr != nil {
+					return CDCEvent{}, false, waitErr
+				}
+				continue
+			}
+			reason = "retry_exhausted"
+		}
+
+		validationErrors.Inc()
+		messagesProcessed.WithLabelValues(msg.Topic, reason).Inc()
+		h.sendToDLQ(msg, reason, fmt.Errorf("failed to decode CDC event: %w", decodeErr), attempt)
+		return CDCEvent{}, false, nil
+	}
+}
+
+// processBatch decodes every message in batch, turns the resulting CDC
+// events into deduplicated relationship writes, and issues a single batched
+// write (falling back to per-relationship writes if the batch endpoint
+// isn't available). It only returns a non-nil error when ctx is cancelled;
+// any write failure is retried or routed to the DLQ internally, so the
+// caller can always mark the batch's offset once this returns nil.
+func (h *ConsumerGroupHandler) processBatch(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+	start := time.Now()
+	batchSizeHistogram.Observe(float64(len(batch)))
+
+	var ops []relationshipOp
+	writable := make([]*sarama.ConsumerMessage, 0, len(batch))
+	for _, msg := range batch {
+		event, ok, err := h.decodeWithRetry(ctx, msg)
+		if err != nil {
+			batchWriteDuration.Observe(time.Since(start).Seconds())
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		writable = append(writable, msg)
+		ops = append(ops, relationshipOpsForEvent(event)...)
+	}
+
+	ops = dedupeRelationshipOps(ops)
+
+	if len(ops) > 0 {
+		wrote, err := h.writeBatchWithRetry(ctx, writable, ops)
+		if err != nil {
+			batchWriteDuration.Observe(time.Since(start).Seconds())
+			return err
+		}
+		if !wrote {
+			// writeBatchWithRetry already routed writable to the DLQ and
+			// labeled each message with its failure reason.
+			batchWriteDuration.Observe(time.Since(start).Seconds())
+			return nil
+		}
+		if h.onReadyChange != nil {
+			h.onReadyChange(true)
+		}
+	}
+
+	// Every decoded message is a success regardless of whether it produced a
+	// relationship op: some tables (e.g. roles) are intentional no-ops, and
+	// those messages are still correctly processed and safe to commit.
+	for _, msg := range writable {
+		messagesProcessed.WithLabelValues(msg.Topic, "success").Inc()
+	}
+
+	batchWriteDuration.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// writeBatchWithRetry retries a batch write with the same classify/backoff
+// policy decodeWithRetry applies per message, scaled up to a whole batch and
+// additionally guarded by a circuit breaker: a terminal error, or exhausting
+// maxRetries, routes every message in the batch to the DLQ rather than
+// blocking the partition. It returns wrote=true only when the write actually
+// succeeded; wrote=false means the batch was routed to the DLQ instead (and
+// its messages already labeled there), not that it should be retried again.
+// The only case that returns a non-nil error is ctx being cancelled mid-retry,
+// so the caller knows not to mark the batch's offset.
+func (h *ConsumerGroupHandler) writeBatchWithRetry(ctx context.Context, batch []*sarama.ConsumerMessage, ops []relationshipOp) (bool, error) {
+	attempt := 0
+	maxBackoff := 5 * time.Minute
+	baseBackoff := 1 * time.Second
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		err := h.runWithBreaker(func() error {
+			return h.writeBatchOnce(ctx, ops)
+		})
+		if err == nil {
+			return true, nil
+		}
+
+		if errors.Is(err, breaker.ErrBreakerOpen) {
+			log.Printf("Relations API circuit breaker open, backing off %v before retrying batch write", h.breakerBackoff)
+			if h.onReadyChange != nil {
+				h.onReadyChange(false)
+			}
+			if waitErr := sleepOrDone(ctx, h.breakerBackoff); waitErr != nil {
+				return false, waitErr
+			}
+			continue
+		}
+
+		terminal, reason := classifyError(err)
+		if !terminal {
+			attempt++
+			retryAttempts.Inc()
+			log.Printf("Error writing relationship batch of %d (attempt %d/%d, reason=%s): %v", len(ops), attempt, h.maxRetries, reason, err)
+
+			if h.maxRetries <= 0 || attempt < h.maxRetries {
+				backoff := time.Duration(math.Min(
+					float64(baseBackoff)*math.Pow(2, float64(attempt-1)),
+					float64(maxBackoff),
+				))
+				jitter := time.Duration(rand.Float64()*0.4-0.2) * backoff
+				backoff += jitter
+
+				log.Printf("Retrying batch write in %v...", backoff)
+				if waitErr := sleepOrDone(ctx, backoff); waitErr != nil {
+					return false, waitErr
+				}
+				continue
+			}
+			reason = "retry_exhausted"
+		}
+
+		log.Printf("Routing batch of %d messages to DLQ (reason=%s): %v", len(batch), reason, err)
+		for _, msg := range batch {
+			messagesProcessed.WithLabelValues(msg.Topic, reason).Inc()
+			h.sendToDLQ(msg, reason, err, attempt)
+		}
+		return false, nil
+	}
+}
+
+func sleepOrDone(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// writeBatchOnce tries the batch endpoint first, switching permanently to
+// per-relationship writes the first time it sees a 404 (i.e. this Relations
+// API deployment's /v1/relationships predates Updates-array support).
+func (h *ConsumerGroupHandler) writeBatchOnce(ctx context.Context, ops []relationshipOp) error {
+	if !h.batchEndpointUnavailable.Load() {
+		err := h.postBatchWrite(ctx, ops)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			log.Printf("Relations API's /v1/relationships doesn't support batched updates, falling back to per-relationship writes")
+			h.batchEndpointUnavailable.Store(true)
+		} else {
+			return err
+		}
+	}
+
+	return h.writeOpsIndividually(ctx, ops)
+}
+
+// postBatchWrite issues the single batched write.
+func (h *ConsumerGroupHandler) postBatchWrite(ctx context.Context, ops []relationshipOp) error {
+	body, err := json.Marshal(batchWriteRequest{Updates: ops})
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch write request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/relationships", h.relationsAPIURL)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to call Relations API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		log.Printf("✓ Batch-wrote %d relationships", len(ops))
+		return nil
+	}
+	return &httpStatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+}
+
+// writeOpsIndividually is the fallback path: one goroutine per op against
+// the same /v1/relationships endpoint, each as its own single-item Updates
+// request, for Relations API deployments that don't support batching them
+// in one round-trip.
+func (h *ConsumerGroupHandler) writeOpsIndividually(ctx context.Context, ops []relationshipOp) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(ops))
+
+	for i, op := range ops {
+		wg.Add(1)
+		go func(i int, op relationshipOp) {
+			defer wg.Done()
+			errs[i] = h.postBatchWrite(ctx, []relationshipOp{op})
+		}(i, op)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			// First error wins; the retry loop above will retry the whole
+			// batch (last-write-wins dedup means re-sending already-written
+			// ops is harmless).
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeRelationshipOps(t *testing.T) {
+	a := relationshipOp{Operation: "touch", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"}
+	aDeleted := a
+	aDeleted.Operation = "delete"
+	b := relationshipOp{Operation: "touch", ResourceType: "rbac/workspace", ResourceID: "w2", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"}
+
+	got := dedupeRelationshipOps([]relationshipOp{a, b, aDeleted})
+	want := []relationshipOp{aDeleted, b}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeRelationshipOps() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDedupeRelationshipOpsEmpty(t *testing.T) {
+	if got := dedupeRelationshipOps(nil); len(got) != 0 {
+		t.Errorf("dedupeRelationshipOps(nil) = %+v, want empty", got)
+	}
+}
+
+func TestRelationshipOpsForEvent(t *testing.T) {
+	workspaceRow := map[string]interface{}{"id": "w1", "tenant_id": "t1"}
+
+	tests := []struct {
+		name  string
+		event CDCEvent
+		want  []relationshipOp
+	}{
+		{
+			name:  "create emits a touch",
+			event: CDCEvent{Op: "c", Table: "workspaces", After: workspaceRow},
+			want: []relationshipOp{
+				{Operation: "touch", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"},
+			},
+		},
+		{
+			name:  "snapshot read emits a touch",
+			event: CDCEvent{Op: "r", Table: "workspaces", After: workspaceRow},
+			want: []relationshipOp{
+				{Operation: "touch", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"},
+			},
+		},
+		{
+			name:  "delete emits a delete",
+			event: CDCEvent{Op: "d", Table: "workspaces", Before: workspaceRow},
+			want: []relationshipOp{
+				{Operation: "delete", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"},
+			},
+		},
+		{
+			name:  "update emits a delete then a touch",
+			event: CDCEvent{Op: "u", Table: "workspaces", After: workspaceRow},
+			want: []relationshipOp{
+				{Operation: "delete", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"},
+				{Operation: "touch", ResourceType: "rbac/workspace", ResourceID: "w1", Relation: "t_parent", SubjectType: "rbac/tenant", SubjectID: "t1"},
+			},
+		},
+		{
+			name:  "unknown op is skipped",
+			event: CDCEvent{Op: "x", Table: "workspaces", After: workspaceRow},
+			want:  nil,
+		},
+		{
+			name:  "roles table is an intentional no-op",
+			event: CDCEvent{Op: "c", Table: "roles", After: map[string]interface{}{"id": "r1"}},
+			want:  nil,
+		},
+		{
+			name:  "unhandled table is skipped",
+			event: CDCEvent{Op: "c", Table: "permissions", After: map[string]interface{}{"id": "p1"}},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := relationshipOpsForEvent(tt.event)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relationshipOpsForEvent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceRelationshipOpsMissingFields(t *testing.T) {
+	if ops := workspaceRelationshipOps("touch", map[string]interface{}{"tenant_id": "t1"}); ops != nil {
+		t.Errorf("workspaceRelationshipOps() with no id = %+v, want nil", ops)
+	}
+	if ops := workspaceRelationshipOps("touch", map[string]interface{}{"id": "w1"}); ops != nil {
+		t.Errorf("workspaceRelationshipOps() with no tenant_id = %+v, want nil", ops)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rbac_kafka_consumer_breaker_state",
+			Help: "Current state of the Relations API circuit breaker (1 for the active state, 0 otherwise)",
+		},
+		[]string{"state"},
+	)
+	breakerTrips = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rbac_kafka_consumer_breaker_trips_total",
+			Help: "Total number of times the Relations API circuit breaker has tripped open",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(breakerState)
+	prometheus.MustRegister(breakerTrips)
+}
+
+// BreakerConfig configures the circuit breaker guarding the Relations API
+// writes in writeBatchOnce, all tunable per deployment since the right thresholds
+// depend on the Relations API's own retry/timeout budget.
+type BreakerConfig struct {
+	ErrorThreshold   int
+	SuccessThreshold int
+	Timeout          time.Duration
+	OpenBackoff      time.Duration
+}
+
+// newRelationsAPIBreaker builds a breaker that opens after ErrorThreshold
+// consecutive failures, half-opens after Timeout, and closes again after
+// SuccessThreshold consecutive successes in the half-open state.
+func newRelationsAPIBreaker(cfg BreakerConfig) *breaker.Breaker {
+	return breaker.New(cfg.ErrorThreshold, cfg.SuccessThreshold, cfg.Timeout)
+}
+
+// recordBreakerState refreshes the breaker_state gauge and counts a trip the
+// moment the breaker transitions into the open state.
+func recordBreakerState(cb *breaker.Breaker, wasOpen bool) (isOpen bool) {
+	state := cb.GetState()
+	isOpen = state == breaker.Open
+
+	breakerState.WithLabelValues("closed").Set(boolToFloat(state == breaker.Closed))
+	breakerState.WithLabelValues("open").Set(boolToFloat(isOpen))
+	breakerState.WithLabelValues("half_open").Set(boolToFloat(state == breaker.HalfOpen))
+
+	if isOpen && !wasOpen {
+		breakerTrips.Inc()
+	}
+	return isOpen
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
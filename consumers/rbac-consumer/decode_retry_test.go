@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// funcDecoder lets a test substitute whatever Decode behavior it needs
+// without a network-backed decoder like AvroSRDecoder.
+type funcDecoder struct {
+	decode func(msg *sarama.ConsumerMessage) (CDCEvent, error)
+}
+
+func (d funcDecoder) Decode(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+	return d.decode(msg)
+}
+
+func newTestHandler(decoder Decoder, maxRetries int) *ConsumerGroupHandler {
+	return &ConsumerGroupHandler{decoder: decoder, maxRetries: maxRetries}
+}
+
+func TestDecodeWithRetryTerminalGoesStraightToDLQ(t *testing.T) {
+	calls := 0
+	h := newTestHandler(funcDecoder{decode: func(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+		calls++
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: errors.New("malformed payload")}
+	}}, 3)
+
+	_, ok, err := h.decodeWithRetry(context.Background(), &sarama.ConsumerMessage{Topic: "t"})
+	if err != nil {
+		t.Fatalf("decodeWithRetry() error = %v, want nil", err)
+	}
+	if ok {
+		t.Fatalf("decodeWithRetry() ok = true, want false for a terminal error")
+	}
+	if calls != 1 {
+		t.Errorf("decoder called %d times, want 1 (terminal errors must not be retried)", calls)
+	}
+}
+
+func TestDecodeWithRetryRetryableRecovers(t *testing.T) {
+	calls := 0
+	want := CDCEvent{Op: "c", Table: "workspaces"}
+	h := newTestHandler(funcDecoder{decode: func(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+		calls++
+		if calls == 1 {
+			return CDCEvent{}, &httpStatusError{StatusCode: 503}
+		}
+		return want, nil
+	}}, 3)
+
+	got, ok, err := h.decodeWithRetry(context.Background(), &sarama.ConsumerMessage{Topic: "t"})
+	if err != nil {
+		t.Fatalf("decodeWithRetry() error = %v, want nil", err)
+	}
+	if !ok || got.Op != want.Op || got.Table != want.Table {
+		t.Fatalf("decodeWithRetry() = (%+v, %v), want (%+v, true)", got, ok, want)
+	}
+	if calls != 2 {
+		t.Errorf("decoder called %d times, want 2 (one failure, one success)", calls)
+	}
+}
+
+func TestDecodeWithRetryExhaustedGoesToDLQ(t *testing.T) {
+	calls := 0
+	h := newTestHandler(funcDecoder{decode: func(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+		calls++
+		return CDCEvent{}, &httpStatusError{StatusCode: 503}
+	}}, 1)
+
+	_, ok, err := h.decodeWithRetry(context.Background(), &sarama.ConsumerMessage{Topic: "t"})
+	if err != nil {
+		t.Fatalf("decodeWithRetry() error = %v, want nil", err)
+	}
+	if ok {
+		t.Fatalf("decodeWithRetry() ok = true, want false once retries are exhausted")
+	}
+	if calls != 1 {
+		t.Errorf("decoder called %d times, want 1 (maxRetries=1 allows no retry)", calls)
+	}
+}
+
+func TestDecodeWithRetryCtxCancelled(t *testing.T) {
+	h := newTestHandler(funcDecoder{decode: func(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+		return CDCEvent{}, &httpStatusError{StatusCode: 503}
+	}}, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, ok, err := h.decodeWithRetry(ctx, &sarama.ConsumerMessage{Topic: "t"})
+	if err == nil {
+		t.Fatal("decodeWithRetry() error = nil, want ctx.Err()")
+	}
+	if ok {
+		t.Error("decodeWithRetry() ok = true, want false when ctx is already cancelled")
+	}
+}
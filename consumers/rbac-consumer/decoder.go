@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+// CDCEvent is the decoder-agnostic shape the rest of the consumer works
+// against, regardless of whether the underlying message was flat JSON
+// (ExtractNewRecordState SMT), full Debezium envelope JSON, or Avro with
+// Confluent Schema Registry.
+type CDCEvent struct {
+	Op     string // c=create, u=update, d=delete, r=read (snapshot)
+	Table  string
+	Before map[string]interface{}
+	After  map[string]interface{}
+	Source CDCSource
+}
+
+// CDCSource carries the Debezium source block's change-tracking metadata.
+type CDCSource struct {
+	TsMs int64
+	LSN  int64
+}
+
+// Fields returns the row data to act on: After when it is populated (always
+// the case for flat-format messages, which only ever populate After),
+// falling back to Before for envelope/avro deletes.
+func (e CDCEvent) Fields() map[string]interface{} {
+	if len(e.After) > 0 {
+		return e.After
+	}
+	return e.Before
+}
+
+// StringField reads a string-ish value out of a decoded row, tolerating
+// non-string JSON types (e.g. a numeric id) by formatting them.
+func StringField(fields map[string]interface{}, key string) string {
+	if fields == nil {
+		return ""
+	}
+	v, ok := fields[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Decoder turns a raw Kafka message into a CDCEvent. Implementations are
+// selected by RBAC_CDC_FORMAT.
+type Decoder interface {
+	Decode(msg *sarama.ConsumerMessage) (CDCEvent, error)
+}
+
+// DecoderConfig configures NewDecoder.
+type DecoderConfig struct {
+	Format             string // "flat" (default), "envelope", or "avro-sr"
+	SchemaRegistryURL  string
+	SchemaRegistryUser string
+	SchemaRegistryPass string
+	SchemaCacheSize    int
+}
+
+// NewDecoder builds the Decoder selected by cfg.Format.
+func NewDecoder(cfg DecoderConfig) (Decoder, error) {
+	switch cfg.Format {
+	case "", "flat":
+		return &FlatJSONDecoder{}, nil
+	case "envelope":
+		return &EnvelopeJSONDecoder{}, nil
+	case "avro-sr":
+		if cfg.SchemaRegistryURL == "" {
+			return nil, fmt.Errorf("RBAC_CDC_FORMAT=avro-sr requires SCHEMA_REGISTRY_URL")
+		}
+		return NewAvroSRDecoder(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown RBAC_CDC_FORMAT %q (want flat, envelope, or avro-sr)", cfg.Format)
+	}
+}
+
+// flatDebeziumEvent is the metadata Debezium's ExtractNewRecordState SMT
+// adds alongside the flattened row, all at the top level of the message.
+type flatDebeziumEvent struct {
+	Op    string `json:"__op"`
+	Table string `json:"__table"`
+	LSN   int64  `json:"__lsn"`
+	TSMS  int64  `json:"__source_ts_ms"`
+}
+
+// FlatJSONDecoder decodes messages produced with the ExtractNewRecordState
+// SMT enabled: a single flat JSON object carrying both the row data and
+// Debezium's __-prefixed metadata fields.
+type FlatJSONDecoder struct{}
+
+func (d *FlatJSONDecoder) Decode(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+	var meta flatDebeziumEvent
+	if err := json.Unmarshal(msg.Value, &meta); err != nil {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("failed to unmarshal flat event: %w", err)}
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &row); err != nil {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("failed to unmarshal flat event fields: %w", err)}
+	}
+
+	return CDCEvent{
+		Op:     meta.Op,
+		Table:  meta.Table,
+		After:  row,
+		Source: CDCSource{TsMs: meta.TSMS, LSN: meta.LSN},
+	}, nil
+}
+
+// envelopePayload is the body of a Debezium change event.
+type envelopePayload struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Op     string                 `json:"op"`
+	Source struct {
+		Table string `json:"table"`
+		TsMs  int64  `json:"ts_ms"`
+		LSN   int64  `json:"lsn"`
+	} `json:"source"`
+}
+
+// envelopeMessage accepts Debezium's full, non-flattened change event,
+// whether the connector wraps it in a top-level "payload" key (schemas
+// enabled) or emits the payload fields directly at the top level.
+type envelopeMessage struct {
+	envelopePayload
+	Payload *envelopePayload `json:"payload"`
+}
+
+// EnvelopeJSONDecoder decodes full Debezium envelope JSON, as emitted when
+// the ExtractNewRecordState SMT is not configured.
+type EnvelopeJSONDecoder struct{}
+
+func (d *EnvelopeJSONDecoder) Decode(msg *sarama.ConsumerMessage) (CDCEvent, error) {
+	var env envelopeMessage
+	if err := json.Unmarshal(msg.Value, &env); err != nil {
+		return CDCEvent{}, &terminalError{reason: "decode_error", err: fmt.Errorf("failed to unmarshal envelope event: %w", err)}
+	}
+
+	payload := env.envelopePayload
+	if env.Payload != nil {
+		payload = *env.Payload
+	}
+
+	return CDCEvent{
+		Op:     payload.Op,
+		Table:  payload.Source.Table,
+		Before: payload.Before,
+		After:  payload.After,
+		Source: CDCSource{TsMs: payload.Source.TsMs, LSN: payload.Source.LSN},
+	}, nil
+}
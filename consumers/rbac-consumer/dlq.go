@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var dlqMessagesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rbac_kafka_consumer_dlq_messages_total",
+		Help: "Total number of messages sent to the dead-letter topic, by reason",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(dlqMessagesTotal)
+}
+
+// httpStatusError is returned by postBatchWrite for a non-2xx Relations API
+// response and by AvroSRDecoder.fetchSchema for a non-200 schema registry
+// response, carrying the status code classifyError needs to tell a
+// transient 5xx from a terminal 4xx.
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP request returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// terminalError marks an error that decodeWithRetry and writeBatchWithRetry
+// never retry (e.g. a malformed payload retrying would never fix), tagged with the
+// dlq reason label to use.
+type terminalError struct {
+	reason string
+	err    error
+}
+
+func (e *terminalError) Error() string { return e.err.Error() }
+func (e *terminalError) Unwrap() error { return e.err }
+
+// classifyError decides whether err is worth retrying. The default for an
+// error type we don't recognize is retryable: it's safer to keep retrying
+// (up to MaxRetries) an error we don't understand than to silently DLQ it.
+func classifyError(err error) (terminal bool, reason string) {
+	var te *terminalError
+	if errors.As(err, &te) {
+		return true, te.reason
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return false, "http_429"
+		case statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+			return true, "http_4xx"
+		case statusErr.StatusCode >= 500:
+			return false, "http_5xx"
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, "timeout"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return false, "connection_error"
+	}
+
+	return false, "unknown"
+}
+
+// sendToDLQ produces the original message, unmodified, to the configured DLQ
+// topic with headers describing why it ended up there, so an operator can
+// replay it after fixing the root cause. If no DLQ topic is configured the
+// message is dropped (logged, counted), matching the old drop-on-error
+// behavior rather than blocking the partition forever.
+func (h *ConsumerGroupHandler) sendToDLQ(msg *sarama.ConsumerMessage, reason string, cause error, retryCount int) {
+	if h.dlqProducer == nil || h.dlqTopic == "" {
+		log.Printf("WARNING: no DLQ configured, dropping message (reason=%s): %v", reason, cause)
+		dlqMessagesTotal.WithLabelValues(reason + "_dropped").Inc()
+		return
+	}
+
+	dlqMsg := &sarama.ProducerMessage{
+		Topic: h.dlqTopic,
+		Key:   sarama.ByteEncoder(msg.Key),
+		Value: sarama.ByteEncoder(msg.Value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("x-original-topic"), Value: []byte(msg.Topic)},
+			{Key: []byte("x-error-class"), Value: []byte(reason)},
+			{Key: []byte("x-error-message"), Value: []byte(cause.Error())},
+			{Key: []byte("x-retry-count"), Value: []byte(strconv.Itoa(retryCount))},
+			{Key: []byte("x-original-timestamp"), Value: []byte(msg.Timestamp.Format(time.RFC3339))},
+		},
+	}
+
+	if _, _, err := h.dlqProducer.SendMessage(dlqMsg); err != nil {
+		log.Printf("ERROR: failed to produce message to DLQ topic %s: %v", h.dlqTopic, err)
+		dlqMessagesTotal.WithLabelValues(reason + "_produce_failed").Inc()
+		return
+	}
+
+	log.Printf("Sent message to DLQ topic %s (reason=%s)", h.dlqTopic, reason)
+	dlqMessagesTotal.WithLabelValues(reason).Inc()
+}
+
+// newDLQProducer builds a sarama.SyncProducer suitable for sendToDLQ: it must
+// wait for the broker ack (Return.Successes) since SendMessage is synchronous.
+func newDLQProducer(brokers []string) (sarama.SyncProducer, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_0_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	return sarama.NewSyncProducer(brokers, config)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantTerminal bool
+		wantReason   string
+	}{
+		{
+			name:         "terminal error passes through its reason",
+			err:          &terminalError{reason: "decode_error", err: errors.New("bad payload")},
+			wantTerminal: true,
+			wantReason:   "decode_error",
+		},
+		{
+			name:         "http 429 is retryable",
+			err:          &httpStatusError{StatusCode: http.StatusTooManyRequests},
+			wantTerminal: false,
+			wantReason:   "http_429",
+		},
+		{
+			name:         "http 4xx is terminal",
+			err:          &httpStatusError{StatusCode: http.StatusBadRequest},
+			wantTerminal: true,
+			wantReason:   "http_4xx",
+		},
+		{
+			name:         "http 5xx is retryable",
+			err:          &httpStatusError{StatusCode: http.StatusInternalServerError},
+			wantTerminal: false,
+			wantReason:   "http_5xx",
+		},
+		{
+			name:         "context deadline exceeded is retryable",
+			err:          context.DeadlineExceeded,
+			wantTerminal: false,
+			wantReason:   "timeout",
+		},
+		{
+			name:         "unrecognized error defaults to retryable",
+			err:          errors.New("something weird"),
+			wantTerminal: false,
+			wantReason:   "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminal, reason := classifyError(tt.err)
+			if terminal != tt.wantTerminal || reason != tt.wantReason {
+				t.Errorf("classifyError(%v) = (%v, %q), want (%v, %q)", tt.err, terminal, reason, tt.wantTerminal, tt.wantReason)
+			}
+		})
+	}
+}
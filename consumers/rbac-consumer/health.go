@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var consumerLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "rbac_kafka_consumer_lag",
+		Help: "Messages behind the partition high water mark, per topic/partition",
+	},
+	[]string{"topic", "partition"},
+)
+
+func init() {
+	prometheus.MustRegister(consumerLag)
+}
+
+// HealthConfig tunes HealthMonitor's liveness/readiness loop.
+type HealthConfig struct {
+	CheckInterval      time.Duration
+	LivenessStaleAfter time.Duration
+	MaxReadyLag        int64
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// HealthMonitor periodically compares the last durably-committed offset per
+// (topic, partition) against the partition's high water mark
+// (sarama.Client.GetOffset(..., OffsetNewest)) and exports the gap as
+// rbac_kafka_consumer_lag. It drives liveness (no progress in
+// LivenessStaleAfter while lag > 0) and readiness (lag exceeds
+// MaxReadyLag), replacing the old "healthy/ready from startup until
+// shutdown" file markers with something that reflects whether the consumer
+// is actually keeping up.
+type HealthMonitor struct {
+	client sarama.Client
+	cfg    HealthConfig
+
+	mu              sync.Mutex
+	lastOffset      map[topicPartition]int64
+	lastProcessedAt time.Time
+
+	healthy atomic.Bool
+	ready   atomic.Bool
+}
+
+// NewHealthMonitor builds a HealthMonitor, starting healthy and ready: with
+// no tracked partitions yet there's nothing to be behind on.
+func NewHealthMonitor(client sarama.Client, cfg HealthConfig) *HealthMonitor {
+	hm := &HealthMonitor{
+		client:     client,
+		cfg:        cfg,
+		lastOffset: make(map[topicPartition]int64),
+	}
+	hm.healthy.Store(true)
+	hm.ready.Store(true)
+	return hm
+}
+
+// MarkProcessed records that offset is the highest message durably
+// committed for (topic, partition). Call this right after
+// session.MarkMessage/session.Commit() succeeds.
+func (hm *HealthMonitor) MarkProcessed(topic string, partition int32, offset int64) {
+	hm.mu.Lock()
+	hm.lastOffset[topicPartition{topic, partition}] = offset
+	hm.lastProcessedAt = time.Now()
+	hm.mu.Unlock()
+}
+
+// Healthy reports the most recently computed liveness state.
+func (hm *HealthMonitor) Healthy() bool { return hm.healthy.Load() }
+
+// Ready reports the most recently computed readiness state.
+func (hm *HealthMonitor) Ready() bool { return hm.ready.Load() }
+
+// Run recomputes lag every CheckInterval until ctx is done, invoking
+// onChange after each recomputation with the resulting (healthy, ready).
+func (hm *HealthMonitor) Run(ctx context.Context, onChange func(healthy, ready bool)) {
+	ticker := time.NewTicker(hm.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hm.refresh()
+			if onChange != nil {
+				onChange(hm.Healthy(), hm.Ready())
+			}
+		}
+	}
+}
+
+func (hm *HealthMonitor) refresh() {
+	hm.mu.Lock()
+	snapshot := make(map[topicPartition]int64, len(hm.lastOffset))
+	for tp, offset := range hm.lastOffset {
+		snapshot[tp] = offset
+	}
+	lastProcessedAt := hm.lastProcessedAt
+	hm.mu.Unlock()
+
+	var maxLag int64
+	for tp, committed := range snapshot {
+		highWaterMark, err := hm.client.GetOffset(tp.topic, tp.partition, sarama.OffsetNewest)
+		if err != nil {
+			log.Printf("Failed to get high water mark for %s/%d: %v", tp.topic, tp.partition, err)
+			continue
+		}
+
+		// GetOffset(..., OffsetNewest) is the offset of the next message to
+		// be produced, so a fully caught-up consumer has committed ==
+		// highWaterMark-1.
+		lag := highWaterMark - committed - 1
+		if lag < 0 {
+			lag = 0
+		}
+
+		consumerLag.WithLabelValues(tp.topic, strconv.Itoa(int(tp.partition))).Set(float64(lag))
+		if lag > maxLag {
+			maxLag = lag
+		}
+	}
+
+	stale := hm.cfg.LivenessStaleAfter > 0 && !lastProcessedAt.IsZero() &&
+		time.Since(lastProcessedAt) > hm.cfg.LivenessStaleAfter && maxLag > 0
+	hm.healthy.Store(!stale)
+
+	ready := hm.cfg.MaxReadyLag <= 0 || maxLag <= hm.cfg.MaxReadyLag
+	hm.ready.Store(ready)
+
+	if stale || !ready {
+		log.Printf("Health monitor: max_lag=%d healthy=%v ready=%v", maxLag, !stale, ready)
+	}
+}
+
+// healthzHandler and readyzHandler back the /healthz and /readyz HTTP
+// endpoints, so deployments can switch from the file-based k8s probes to
+// HTTP probes against the metrics port.
+func healthzHandler(check func() bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if check() {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "ok")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "unavailable")
+	}
+}
@@ -1,21 +1,21 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"math"
-	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/eapache/go-resiliency/breaker"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -41,62 +41,51 @@ var (
 			Help: "Total number of retry attempts",
 		},
 	)
-	processingDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "rbac_kafka_consumer_message_processing_duration_seconds",
-			Help:    "Message processing duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"topic"},
-	)
 )
 
 func init() {
 	prometheus.MustRegister(messagesProcessed)
 	prometheus.MustRegister(validationErrors)
 	prometheus.MustRegister(retryAttempts)
-	prometheus.MustRegister(processingDuration)
-}
-
-// DebeziumEvent represents a Debezium CDC event (flattened by ExtractNewRecordState SMT)
-type DebeziumEvent struct {
-	// Flattened fields - all data fields are at top level
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	WorkspaceID string `json:"workspace_id"` // For roles
-	TenantID    string `json:"tenant_id"`    // For workspaces
-	CreatedAt   int64  `json:"created_at"`
-	UpdatedAt   int64  `json:"updated_at"`
-
-	// Debezium metadata fields
-	Op      string `json:"__op"`      // c=create, u=update, d=delete, r=read(snapshot)
-	Table   string `json:"__table"`   // Table name
-	LSN     int64  `json:"__lsn"`     // Log sequence number
-	TSMS    int64  `json:"__source_ts_ms"`
-	Deleted string `json:"__deleted"` // "true" or "false"
 }
 
-// RelationshipRequest represents a request to create/delete a relationship
-// This matches the format expected by kessel-relations-api
-type RelationshipRequest struct {
-	ResourceType string `json:"resource_type"`
-	ResourceID   string `json:"resource_id"`
-	Relation     string `json:"relation"`
-	SubjectType  string `json:"subject_type"`
-	SubjectID    string `json:"subject_id"`
+// TopicConfig selects which topics RBACConsumer subscribes to: either a
+// static list, or a regex resolved (and periodically re-resolved) against
+// live cluster metadata.
+type TopicConfig struct {
+	Static               []string
+	Regex                string
+	RefreshInterval      time.Duration
+	RebalanceOnDiscovery bool
 }
 
 // RBACConsumer consumes RBAC events and creates relationships in Kessel
 type RBACConsumer struct {
 	relationsAPIURL string
 	consumer        sarama.ConsumerGroup
-	topics          []string
+	topicDiscoverer *TopicDiscoverer
 	healthPath      string
 	readyPath       string
+	dlqProducer     sarama.SyncProducer
+	dlqTopic        string
+	maxRetries      int
+	breaker         *breaker.Breaker
+	breakerBackoff  time.Duration
+	decoder         Decoder
+	batchCfg        BatchConfig
+	client          sarama.Client
+	healthMonitor   *HealthMonitor
+
+	topicsMu sync.RWMutex
+	topics   []string
+
+	triggerMu        sync.Mutex
+	rebalanceTrigger context.CancelFunc
+
+	breakerReady atomic.Bool
 }
 
-func NewRBACConsumer(brokers []string, groupID, relationsAPIURL string, topics []string) (*RBACConsumer, error) {
+func NewRBACConsumer(brokers []string, groupID, relationsAPIURL string, topicCfg TopicConfig, dlqTopic string, maxRetries int, breakerCfg BreakerConfig, decoderCfg DecoderConfig, batchCfg BatchConfig, healthCfg HealthConfig) (*RBACConsumer, error) {
 	config := sarama.NewConfig()
 	config.Version = sarama.V3_0_0_0
 	config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRoundRobin()
@@ -105,18 +94,64 @@ func NewRBACConsumer(brokers []string, groupID, relationsAPIURL string, topics [
 	// Manual offset commit for exactly-once processing
 	config.Consumer.Offsets.AutoCommit.Enable = false
 
-	consumer, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerGroupFromClient(groupID, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create consumer group: %w", err)
 	}
 
-	return &RBACConsumer{
+	var dlqProducer sarama.SyncProducer
+	if dlqTopic != "" {
+		dlqProducer, err = newDLQProducer(brokers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DLQ producer: %w", err)
+		}
+	}
+
+	decoder, err := NewDecoder(decoderCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build CDC decoder: %w", err)
+	}
+
+	topics := topicCfg.Static
+	var topicDiscoverer *TopicDiscoverer
+	if topicCfg.Regex != "" {
+		topicDiscoverer, err = NewTopicDiscoverer(client, topicCfg.Regex, topicCfg.RefreshInterval, topicCfg.RebalanceOnDiscovery)
+		if err != nil {
+			return nil, err
+		}
+		topics, err = topicDiscoverer.Discover()
+		if err != nil {
+			return nil, fmt.Errorf("failed initial topic discovery: %w", err)
+		}
+		if len(topics) == 0 {
+			log.Printf("WARNING: no topics matched regex %q at startup", topicCfg.Regex)
+		}
+	}
+
+	rc := &RBACConsumer{
 		relationsAPIURL: relationsAPIURL,
 		consumer:        consumer,
+		topicDiscoverer: topicDiscoverer,
 		topics:          topics,
 		healthPath:      "/tmp/kubernetes-liveness",
 		readyPath:       "/tmp/kubernetes-readiness",
-	}, nil
+		dlqProducer:     dlqProducer,
+		dlqTopic:        dlqTopic,
+		maxRetries:      maxRetries,
+		breaker:         newRelationsAPIBreaker(breakerCfg),
+		breakerBackoff:  breakerCfg.OpenBackoff,
+		decoder:         decoder,
+		batchCfg:        batchCfg,
+		client:          client,
+		healthMonitor:   NewHealthMonitor(client, healthCfg),
+	}
+	rc.breakerReady.Store(true)
+	return rc, nil
 }
 
 func (c *RBACConsumer) Start(ctx context.Context) error {
@@ -129,8 +164,23 @@ func (c *RBACConsumer) Start(ctx context.Context) error {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		dlqProducer:    c.dlqProducer,
+		dlqTopic:       c.dlqTopic,
+		maxRetries:     c.maxRetries,
+		breaker:        c.breaker,
+		breakerBackoff: c.breakerBackoff,
+		onReadyChange:  c.setBreakerReady,
+		decoder:        c.decoder,
+		batchSize:      c.batchCfg.Size,
+		batchLinger:    c.batchCfg.LingerMs,
+		healthMonitor:  c.healthMonitor,
 	}
 
+	if c.topicDiscoverer != nil {
+		go c.topicDiscoverer.Run(ctx, c.setTopics)
+	}
+	go c.healthMonitor.Run(ctx, c.onLagHealthChange)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -138,15 +188,88 @@ func (c *RBACConsumer) Start(ctx context.Context) error {
 			c.updateReadyStatus(false)
 			return ctx.Err()
 		default:
-			if err := c.consumer.Consume(ctx, c.topics, handler); err != nil {
+			// consumeCtx is cancelled either by outer shutdown or by
+			// setTopics, so a discovered topic-set change forces
+			// Consume to return and re-join the group with the new list.
+			consumeCtx, cancel := context.WithCancel(ctx)
+			c.setRebalanceTrigger(cancel)
+
+			if err := c.consumer.Consume(consumeCtx, c.Topics(), handler); err != nil && ctx.Err() == nil {
 				log.Printf("Error from consumer: %v", err)
 				c.updateReadyStatus(false)
 				time.Sleep(5 * time.Second) // Brief pause before retry
 			}
+			cancel()
 		}
 	}
 }
 
+// Topics returns the topic list currently being consumed, for the /topics
+// HTTP endpoint and for each Consume() call.
+func (c *RBACConsumer) Topics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	out := make([]string, len(c.topics))
+	copy(out, c.topics)
+	return out
+}
+
+// setTopics is the TopicDiscoverer's onChange callback: it records the new
+// topic set and, if a Consume() call is currently in flight, cancels it so
+// Start's loop re-joins the group subscribed to the new set.
+func (c *RBACConsumer) setTopics(topics []string) {
+	c.topicsMu.Lock()
+	c.topics = topics
+	c.topicsMu.Unlock()
+
+	c.triggerMu.Lock()
+	cancel := c.rebalanceTrigger
+	c.triggerMu.Unlock()
+
+	if cancel != nil {
+		log.Printf("Re-subscribing with discovered topic set: %v", topics)
+		cancel()
+	}
+}
+
+func (c *RBACConsumer) setRebalanceTrigger(cancel context.CancelFunc) {
+	c.triggerMu.Lock()
+	c.rebalanceTrigger = cancel
+	c.triggerMu.Unlock()
+}
+
+// setBreakerReady is the handler's onReadyChange callback: it records
+// whether the Relations API circuit breaker currently allows writes, which
+// combines with the lag-based readiness from healthMonitor to drive the
+// readiness file and /readyz.
+func (c *RBACConsumer) setBreakerReady(ready bool) {
+	c.breakerReady.Store(ready)
+	c.recomputeStatus()
+}
+
+// onLagHealthChange is healthMonitor's onChange callback, invoked after
+// every lag recomputation.
+func (c *RBACConsumer) onLagHealthChange(healthy, ready bool) {
+	c.updateHealthStatus(healthy)
+	c.recomputeStatus()
+}
+
+// recomputeStatus combines breaker-derived and lag-derived readiness into a
+// single readiness signal.
+func (c *RBACConsumer) recomputeStatus() {
+	c.updateReadyStatus(c.breakerReady.Load() && c.healthMonitor.Ready())
+}
+
+// Healthy reports the consumer's current liveness, for /healthz.
+func (c *RBACConsumer) Healthy() bool {
+	return c.healthMonitor.Healthy()
+}
+
+// Ready reports the consumer's current readiness, for /readyz.
+func (c *RBACConsumer) Ready() bool {
+	return c.breakerReady.Load() && c.healthMonitor.Ready()
+}
+
 func (c *RBACConsumer) updateHealthStatus(healthy bool) {
 	if healthy {
 		os.WriteFile(c.healthPath, []byte("healthy"), 0644)
@@ -166,13 +289,45 @@ func (c *RBACConsumer) updateReadyStatus(ready bool) {
 func (c *RBACConsumer) Close() error {
 	c.updateHealthStatus(false)
 	c.updateReadyStatus(false)
+	if c.dlqProducer != nil {
+		if err := c.dlqProducer.Close(); err != nil {
+			log.Printf("Error closing DLQ producer: %v", err)
+		}
+	}
 	return c.consumer.Close()
 }
 
-// ConsumerGroupHandler handles consumed messages with infinite retry logic
+// ConsumerGroupHandler handles consumed messages, retrying transient errors
+// up to maxRetries before routing the message to the DLQ topic. Terminal
+// errors (bad schema, malformed payloads) skip straight to the DLQ.
 type ConsumerGroupHandler struct {
 	relationsAPIURL string
 	httpClient      *http.Client
+	dlqProducer     sarama.SyncProducer
+	dlqTopic        string
+	maxRetries      int
+	breaker         *breaker.Breaker
+	breakerBackoff  time.Duration
+	onReadyChange   func(bool)
+	decoder         Decoder
+	batchSize       int
+	batchLinger     time.Duration
+	healthMonitor   *HealthMonitor
+
+	// batchEndpointUnavailable latches true the first time /v1/relationships
+	// 404s on an Updates-array body, so later batches go straight to the
+	// per-relationship fallback instead of re-probing every time.
+	batchEndpointUnavailable atomic.Bool
+}
+
+// runWithBreaker executes work through h.breaker, keeping the
+// breaker_state gauge and breaker_trips_total counter up to date around
+// the call.
+func (h *ConsumerGroupHandler) runWithBreaker(work func() error) error {
+	wasOpen := h.breaker.GetState() == breaker.Open
+	err := h.breaker.Run(work)
+	recordBreakerState(h.breaker, wasOpen)
+	return err
 }
 
 func (h *ConsumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error {
@@ -185,329 +340,225 @@ func (h *ConsumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 	return nil
 }
 
+// ConsumeClaim accumulates messages into a batch of up to batchSize, or
+// until batchLinger elapses since the first message of the in-progress
+// batch, whichever comes first, then flushes the batch as a single
+// relationship write. Offsets are only marked once a batch write succeeds
+// (or is routed to the DLQ), preserving at-least-once semantics across a
+// crash mid-batch.
 func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		// Process message with infinite retry
-		h.processMessageWithRetry(message)
+	ctx := session.Context()
 
-		// Only commit offset after successful processing
-		session.MarkMessage(message, "")
-		session.Commit()
+	batchSize := h.batchSize
+	if batchSize <= 0 {
+		batchSize = 1
 	}
-	return nil
-}
+	batch := make([]*sarama.ConsumerMessage, 0, batchSize)
 
-// processMessageWithRetry implements infinite retry with exponential backoff
-func (h *ConsumerGroupHandler) processMessageWithRetry(msg *sarama.ConsumerMessage) {
-	attempt := 0
-	maxBackoff := 5 * time.Minute
-	baseBackoff := 1 * time.Second
+	var lingerTimer *time.Timer
+	var lingerC <-chan time.Time
 
-	for {
-		start := time.Now()
-		err := h.processMessage(msg)
-		duration := time.Since(start).Seconds()
-
-		processingDuration.WithLabelValues(msg.Topic).Observe(duration)
-
-		if err == nil {
-			messagesProcessed.WithLabelValues(msg.Topic, "success").Inc()
-			return
+	stopLinger := func() {
+		if lingerTimer != nil {
+			lingerTimer.Stop()
+			lingerTimer = nil
+			lingerC = nil
 		}
-
-		// Log error and retry
-		attempt++
-		retryAttempts.Inc()
-		log.Printf("Error processing message (attempt %d): %v", attempt, err)
-
-		// Calculate backoff with exponential increase and jitter
-		backoff := time.Duration(math.Min(
-			float64(baseBackoff)*math.Pow(2, float64(attempt-1)),
-			float64(maxBackoff),
-		))
-
-		// Add jitter (±20%)
-		jitter := time.Duration(rand.Float64()*0.4-0.2) * backoff
-		backoff += jitter
-
-		log.Printf("Retrying in %v...", backoff)
-		time.Sleep(backoff)
 	}
-}
-
-func (h *ConsumerGroupHandler) processMessage(msg *sarama.ConsumerMessage) error {
-	log.Printf("Processing message from topic %s, partition %d, offset %d",
-		msg.Topic, msg.Partition, msg.Offset)
 
-	var event DebeziumEvent
-	if err := json.Unmarshal(msg.Value, &event); err != nil {
-		validationErrors.Inc()
-		log.Printf("WARNING: Failed to unmarshal event (skipping): %v", err)
-		// Skip malformed messages - don't retry
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := h.processBatch(ctx, batch); err != nil {
+			return err
+		}
+		last := batch[len(batch)-1]
+		session.MarkMessage(last, "")
+		session.Commit()
+		if h.healthMonitor != nil {
+			h.healthMonitor.MarkProcessed(last.Topic, last.Partition, last.Offset)
+		}
+		batch = batch[:0]
+		stopLinger()
 		return nil
 	}
 
-	log.Printf("Event: op=%s, table=%s", event.Op, event.Table)
-
-	// Handle different operations
-	switch event.Op {
-	case "c", "r": // Create or Read (snapshot)
-		return h.handleCreate(event)
-	case "u": // Update
-		return h.handleUpdate(event)
-	case "d": // Delete
-		return h.handleDelete(event)
-	default:
-		log.Printf("Unknown operation: %s (skipping)", event.Op)
-		return nil
+	for {
+		select {
+		case <-ctx.Done():
+			return flush()
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return flush()
+			}
+			batch = append(batch, msg)
+			if len(batch) == 1 && h.batchLinger > 0 {
+				lingerTimer = time.NewTimer(h.batchLinger)
+				lingerC = lingerTimer.C
+			}
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-lingerC:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
 	}
 }
 
-func (h *ConsumerGroupHandler) handleCreate(event DebeziumEvent) error {
-	switch event.Table {
-	case "workspaces":
-		return h.createWorkspaceRelationships(event)
-	case "roles":
-		return h.createRoleRelationships(event)
-	default:
-		log.Printf("Unhandled table: %s", event.Table)
+func main() {
+	// Configuration from environment
+	kafkaBrokers := getEnv("KAFKA_BROKERS", "kafka:29092")
+	groupID := getEnv("RBAC_KAFKA_CONSUMER_GROUP_ID", "rbac-consumer-group")
+	relationsAPIURL := getEnv("KESSEL_RELATIONS_API_URL", "http://kessel-relations-api:8000")
+	metricsPort := getEnv("METRICS_PORT", "9090")
+	dlqTopic := getEnv("RBAC_KAFKA_DLQ_TOPIC", "rbac.events.dlq")
+	maxRetries, err := strconv.Atoi(getEnv("RBAC_KAFKA_MAX_RETRIES", "5"))
+	if err != nil || maxRetries < 0 {
+		log.Fatalf("Invalid RBAC_KAFKA_MAX_RETRIES: %q", os.Getenv("RBAC_KAFKA_MAX_RETRIES"))
 	}
-	return nil
-}
 
-func (h *ConsumerGroupHandler) handleUpdate(event DebeziumEvent) error {
-	// For simplicity, treat update as delete + create
-	// This ensures all relationships are refreshed
-	if err := h.handleDelete(event); err != nil {
-		return err
+	breakerErrorThreshold, err := strconv.Atoi(getEnv("RBAC_BREAKER_ERROR_THRESHOLD", "5"))
+	if err != nil || breakerErrorThreshold <= 0 {
+		log.Fatalf("Invalid RBAC_BREAKER_ERROR_THRESHOLD: %q", os.Getenv("RBAC_BREAKER_ERROR_THRESHOLD"))
 	}
-	return h.handleCreate(event)
-}
-
-func (h *ConsumerGroupHandler) handleDelete(event DebeziumEvent) error {
-	switch event.Table {
-	case "workspaces":
-		return h.deleteWorkspaceRelationships(event)
-	case "roles":
-		return h.deleteRoleRelationships(event)
-	default:
-		log.Printf("Unhandled table: %s", event.Table)
+	breakerSuccessThreshold, err := strconv.Atoi(getEnv("RBAC_BREAKER_SUCCESS_THRESHOLD", "2"))
+	if err != nil || breakerSuccessThreshold <= 0 {
+		log.Fatalf("Invalid RBAC_BREAKER_SUCCESS_THRESHOLD: %q", os.Getenv("RBAC_BREAKER_SUCCESS_THRESHOLD"))
 	}
-	return nil
-}
-
-// createWorkspaceRelationships creates relationships for a workspace using production schema
-func (h *ConsumerGroupHandler) createWorkspaceRelationships(event DebeziumEvent) error {
-	if event.ID == "" {
-		validationErrors.Inc()
-		log.Printf("WARNING: workspace id not found (skipping)")
-		return nil
+	breakerTimeout, err := time.ParseDuration(getEnv("RBAC_BREAKER_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid RBAC_BREAKER_TIMEOUT: %q", os.Getenv("RBAC_BREAKER_TIMEOUT"))
 	}
-
-	log.Printf("Creating relationships for workspace: %s (name: %s)", event.ID, event.Name)
-
-	// Relationship 1: workspace -> parent tenant
-	// rbac/workspace:workspace_id#t_parent@rbac/tenant:tenant_id
-	if event.TenantID != "" {
-		relationship := &RelationshipRequest{
-			ResourceType: "rbac/workspace",
-			ResourceID:   event.ID,
-			Relation:     "t_parent",
-			SubjectType:  "rbac/tenant",
-			SubjectID:    event.TenantID,
-		}
-		if err := h.createRelationship(relationship); err != nil {
-			return err
-		}
+	breakerOpenBackoff, err := time.ParseDuration(getEnv("RBAC_BREAKER_OPEN_BACKOFF", "5s"))
+	if err != nil {
+		log.Fatalf("Invalid RBAC_BREAKER_OPEN_BACKOFF: %q", os.Getenv("RBAC_BREAKER_OPEN_BACKOFF"))
 	}
-
-	// Relationship 2: Default admin ownership (for demo purposes)
-	// In production, this would come from actual user/role data
-	// rbac/workspace:workspace_id#t_binding@rbac/role_binding:binding_id
-	// For now, we'll skip this as it requires additional role binding data
-
-	return nil
-}
-
-// createRoleRelationships creates relationships for a role using production schema
-func (h *ConsumerGroupHandler) createRoleRelationships(event DebeziumEvent) error {
-	if event.ID == "" {
-		validationErrors.Inc()
-		log.Printf("WARNING: role id not found (skipping)")
-		return nil
+	breakerCfg := BreakerConfig{
+		ErrorThreshold:   breakerErrorThreshold,
+		SuccessThreshold: breakerSuccessThreshold,
+		Timeout:          breakerTimeout,
+		OpenBackoff:      breakerOpenBackoff,
 	}
 
-	if event.WorkspaceID == "" {
-		validationErrors.Inc()
-		log.Printf("WARNING: workspace_id not found for role (skipping)")
-		return nil
+	topicRegex := getEnv("RBAC_KAFKA_TOPIC_REGEX", "")
+	topicRefreshInterval, err := time.ParseDuration(getEnv("RBAC_KAFKA_TOPIC_REFRESH_INTERVAL", "60s"))
+	if err != nil {
+		log.Fatalf("Invalid RBAC_KAFKA_TOPIC_REFRESH_INTERVAL: %q", os.Getenv("RBAC_KAFKA_TOPIC_REFRESH_INTERVAL"))
 	}
-
-	log.Printf("Creating relationships for role: %s (name: %s) in workspace: %s",
-		event.ID, event.Name, event.WorkspaceID)
-
-	// Note: The production schema doesn't have a simple "role belongs to workspace" relationship
-	// Instead, roles are bound to resources via role_bindings
-	// For this demo, we'll skip role relationships as they require the full binding context
-
-	log.Printf("Note: Role relationships require role_binding context - skipping for now")
-	return nil
-}
-
-// deleteWorkspaceRelationships deletes relationships for a workspace
-func (h *ConsumerGroupHandler) deleteWorkspaceRelationships(event DebeziumEvent) error {
-	if event.ID == "" {
-		validationErrors.Inc()
-		log.Printf("WARNING: workspace id not found for deletion (skipping)")
-		return nil
+	rebalanceOnDiscovery, err := strconv.ParseBool(getEnv("RBAC_KAFKA_REBALANCE_ON_DISCOVERY", "true"))
+	if err != nil {
+		log.Fatalf("Invalid RBAC_KAFKA_REBALANCE_ON_DISCOVERY: %q", os.Getenv("RBAC_KAFKA_REBALANCE_ON_DISCOVERY"))
 	}
-
-	log.Printf("Deleting relationships for workspace: %s", event.ID)
-
-	// Delete parent relationship
-	if event.TenantID != "" {
-		relationship := &RelationshipRequest{
-			ResourceType: "rbac/workspace",
-			ResourceID:   event.ID,
-			Relation:     "t_parent",
-			SubjectType:  "rbac/tenant",
-			SubjectID:    event.TenantID,
-		}
-		if err := h.deleteRelationship(relationship); err != nil {
-			return err
-		}
+	topicCfg := TopicConfig{
+		Static: []string{
+			getEnv("RBAC_KAFKA_CONSUMER_TOPIC_WORKSPACES", "rbac.workspaces.events"),
+			getEnv("RBAC_KAFKA_CONSUMER_TOPIC_ROLES", "rbac.roles.events"),
+		},
+		Regex:                topicRegex,
+		RefreshInterval:      topicRefreshInterval,
+		RebalanceOnDiscovery: rebalanceOnDiscovery,
 	}
 
-	return nil
-}
-
-// deleteRoleRelationships deletes relationships for a role
-func (h *ConsumerGroupHandler) deleteRoleRelationships(event DebeziumEvent) error {
-	if event.ID == "" {
-		validationErrors.Inc()
-		log.Printf("WARNING: role id not found for deletion (skipping)")
-		return nil
+	schemaCacheSize, err := strconv.Atoi(getEnv("RBAC_SCHEMA_REGISTRY_CACHE_SIZE", "100"))
+	if err != nil || schemaCacheSize <= 0 {
+		log.Fatalf("Invalid RBAC_SCHEMA_REGISTRY_CACHE_SIZE: %q", os.Getenv("RBAC_SCHEMA_REGISTRY_CACHE_SIZE"))
 	}
-
-	log.Printf("Deleting relationships for role: %s", event.ID)
-	// Role relationship deletion would happen here if we had role relationships
-	return nil
-}
-
-// createRelationship creates a relationship in SpiceDB via the Relations API
-// Implements the retry logic for transient failures
-func (h *ConsumerGroupHandler) createRelationship(req *RelationshipRequest) error {
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal relationship request: %w", err)
+	decoderCfg := DecoderConfig{
+		Format:             getEnv("RBAC_CDC_FORMAT", "flat"),
+		SchemaRegistryURL:  getEnv("SCHEMA_REGISTRY_URL", ""),
+		SchemaRegistryUser: getEnv("SCHEMA_REGISTRY_USERNAME", ""),
+		SchemaRegistryPass: getEnv("SCHEMA_REGISTRY_PASSWORD", ""),
+		SchemaCacheSize:    schemaCacheSize,
 	}
 
-	url := fmt.Sprintf("%s/v1/relationships", h.relationsAPIURL)
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+	batchSize, err := strconv.Atoi(getEnv("RBAC_KAFKA_BATCH_SIZE", "500"))
+	if err != nil || batchSize <= 0 {
+		log.Fatalf("Invalid RBAC_KAFKA_BATCH_SIZE: %q", os.Getenv("RBAC_KAFKA_BATCH_SIZE"))
 	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	log.Printf("Creating relationship: %s:%s#%s@%s:%s",
-		req.ResourceType, req.ResourceID,
-		req.Relation,
-		req.SubjectType, req.SubjectID)
-
-	resp, err := h.httpClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("failed to call Relations API: %w", err)
+	batchLingerMs, err := time.ParseDuration(getEnv("RBAC_KAFKA_BATCH_LINGER_MS", "1000ms"))
+	if err != nil || batchLingerMs < 0 {
+		log.Fatalf("Invalid RBAC_KAFKA_BATCH_LINGER_MS: %q", os.Getenv("RBAC_KAFKA_BATCH_LINGER_MS"))
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("✓ Successfully created relationship")
-		return nil
+	batchCfg := BatchConfig{
+		Size:     batchSize,
+		LingerMs: batchLingerMs,
 	}
 
-	// Return error to trigger retry
-	return fmt.Errorf("Relations API returned status %d: %s", resp.StatusCode, string(body))
-}
-
-// deleteRelationship deletes a relationship from SpiceDB via the Relations API
-func (h *ConsumerGroupHandler) deleteRelationship(req *RelationshipRequest) error {
-	jsonData, err := json.Marshal(req)
+	healthCheckInterval, err := time.ParseDuration(getEnv("RBAC_HEALTH_CHECK_INTERVAL", "15s"))
 	if err != nil {
-		return fmt.Errorf("failed to marshal relationship request: %w", err)
+		log.Fatalf("Invalid RBAC_HEALTH_CHECK_INTERVAL: %q", os.Getenv("RBAC_HEALTH_CHECK_INTERVAL"))
 	}
-
-	url := fmt.Sprintf("%s/v1/relationships", h.relationsAPIURL)
-	httpReq, err := http.NewRequest("DELETE", url, bytes.NewBuffer(jsonData))
+	livenessStaleAfter, err := time.ParseDuration(getEnv("RBAC_LIVENESS_STALE_AFTER", "5m"))
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+		log.Fatalf("Invalid RBAC_LIVENESS_STALE_AFTER: %q", os.Getenv("RBAC_LIVENESS_STALE_AFTER"))
 	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	log.Printf("Deleting relationship: %s:%s#%s@%s:%s",
-		req.ResourceType, req.ResourceID,
-		req.Relation,
-		req.SubjectType, req.SubjectID)
-
-	resp, err := h.httpClient.Do(httpReq)
+	maxReadyLag, err := strconv.ParseInt(getEnv("RBAC_MAX_READY_LAG", "10000"), 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to call Relations API: %w", err)
+		log.Fatalf("Invalid RBAC_MAX_READY_LAG: %q", os.Getenv("RBAC_MAX_READY_LAG"))
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("✓ Successfully deleted relationship")
-		return nil
-	}
-
-	return fmt.Errorf("Relations API returned status %d: %s", resp.StatusCode, string(body))
-}
-
-func main() {
-	// Configuration from environment
-	kafkaBrokers := getEnv("KAFKA_BROKERS", "kafka:29092")
-	groupID := getEnv("RBAC_KAFKA_CONSUMER_GROUP_ID", "rbac-consumer-group")
-	relationsAPIURL := getEnv("KESSEL_RELATIONS_API_URL", "http://kessel-relations-api:8000")
-	metricsPort := getEnv("METRICS_PORT", "9090")
-
-	topics := []string{
-		getEnv("RBAC_KAFKA_CONSUMER_TOPIC_WORKSPACES", "rbac.workspaces.events"),
-		getEnv("RBAC_KAFKA_CONSUMER_TOPIC_ROLES", "rbac.roles.events"),
+	healthCfg := HealthConfig{
+		CheckInterval:      healthCheckInterval,
+		LivenessStaleAfter: livenessStaleAfter,
+		MaxReadyLag:        maxReadyLag,
 	}
 
 	log.Printf("Starting RBAC Kafka Consumer")
 	log.Printf("Kafka Brokers: %s", kafkaBrokers)
 	log.Printf("Consumer Group: %s", groupID)
 	log.Printf("Relations API: %s", relationsAPIURL)
-	log.Printf("Topics: %v", topics)
+	if topicRegex != "" {
+		log.Printf("Topic Regex: %s (refresh_interval=%v rebalance_on_discovery=%v)", topicRegex, topicRefreshInterval, rebalanceOnDiscovery)
+	} else {
+		log.Printf("Topics: %v", topicCfg.Static)
+	}
 	log.Printf("Metrics Port: %s", metricsPort)
-
-	// Start Prometheus metrics server
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		addr := fmt.Sprintf(":%s", metricsPort)
-		log.Printf("Starting metrics server on %s", addr)
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Printf("Metrics server error: %v", err)
-		}
-	}()
+	log.Printf("DLQ Topic: %s", dlqTopic)
+	log.Printf("Max Retries: %d", maxRetries)
+	log.Printf("Breaker: error_threshold=%d success_threshold=%d timeout=%v open_backoff=%v",
+		breakerErrorThreshold, breakerSuccessThreshold, breakerTimeout, breakerOpenBackoff)
+	log.Printf("CDC Format: %s", decoderCfg.Format)
+	log.Printf("Batch: size=%d linger=%v", batchCfg.Size, batchCfg.LingerMs)
+	log.Printf("Health: check_interval=%v liveness_stale_after=%v max_ready_lag=%d",
+		healthCfg.CheckInterval, healthCfg.LivenessStaleAfter, healthCfg.MaxReadyLag)
 
 	consumer, err := NewRBACConsumer(
 		[]string{kafkaBrokers},
 		groupID,
 		relationsAPIURL,
-		topics,
+		topicCfg,
+		dlqTopic,
+		maxRetries,
+		breakerCfg,
+		decoderCfg,
+		batchCfg,
+		healthCfg,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create consumer: %v", err)
 	}
 	defer consumer.Close()
 
+	// Start Prometheus metrics, topic-discovery, and health-check HTTP servers
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		http.HandleFunc("/topics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string][]string{"topics": consumer.Topics()})
+		})
+		http.HandleFunc("/healthz", healthzHandler(consumer.Healthy))
+		http.HandleFunc("/readyz", healthzHandler(consumer.Ready))
+		addr := fmt.Sprintf(":%s", metricsPort)
+		log.Printf("Starting metrics server on %s", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
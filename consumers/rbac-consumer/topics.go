@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TopicDiscoverer periodically polls cluster metadata for topics matching a
+// regex, so Debezium's one-topic-per-table convention doesn't require a code
+// change and redeploy every time a new table (role_bindings, principals,
+// groups, permissions, ...) is added to the CDC pipeline.
+type TopicDiscoverer struct {
+	client               sarama.Client
+	pattern              *regexp.Regexp
+	refreshInterval      time.Duration
+	rebalanceOnDiscovery bool
+
+	mu     sync.RWMutex
+	topics []string
+}
+
+// NewTopicDiscoverer compiles regex and builds a discoverer that reads
+// cluster metadata through client.
+func NewTopicDiscoverer(client sarama.Client, regex string, refreshInterval time.Duration, rebalanceOnDiscovery bool) (*TopicDiscoverer, error) {
+	pattern, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic regex %q: %w", regex, err)
+	}
+
+	return &TopicDiscoverer{
+		client:               client,
+		pattern:              pattern,
+		refreshInterval:      refreshInterval,
+		rebalanceOnDiscovery: rebalanceOnDiscovery,
+	}, nil
+}
+
+// Discover refreshes cluster metadata and returns the sorted list of topics
+// currently matching the configured regex.
+func (d *TopicDiscoverer) Discover() ([]string, error) {
+	if err := d.client.RefreshMetadata(); err != nil {
+		return nil, fmt.Errorf("failed to refresh metadata: %w", err)
+	}
+
+	all, err := d.client.Topics()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	var matched []string
+	for _, topic := range all {
+		if d.pattern.MatchString(topic) {
+			matched = append(matched, topic)
+		}
+	}
+	sort.Strings(matched)
+
+	d.mu.Lock()
+	d.topics = matched
+	d.mu.Unlock()
+
+	return matched, nil
+}
+
+// Topics returns the most recently discovered topic list, for the /topics
+// HTTP endpoint.
+func (d *TopicDiscoverer) Topics() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]string, len(d.topics))
+	copy(out, d.topics)
+	return out
+}
+
+// Run polls Discover every RefreshInterval until ctx is done, invoking
+// onChange with the new topic set whenever discovery finds a different set
+// of topics and rebalanceOnDiscovery is enabled.
+func (d *TopicDiscoverer) Run(ctx context.Context, onChange func([]string)) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			previous := d.Topics()
+			current, err := d.Discover()
+			if err != nil {
+				log.Printf("Topic discovery error: %v", err)
+				continue
+			}
+
+			if topicsEqual(previous, current) {
+				continue
+			}
+
+			log.Printf("Discovered topic set changed: %v -> %v", previous, current)
+			if d.rebalanceOnDiscovery && onChange != nil {
+				onChange(current)
+			}
+		}
+	}
+}
+
+func topicsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
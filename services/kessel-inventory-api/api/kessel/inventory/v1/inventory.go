@@ -0,0 +1,205 @@
+// Package inventoryv1 is the typed contract for InventoryService, mirroring
+// proto/kessel/inventory/v1/inventory.proto. A future `make proto` pass
+// (protoc + protoc-gen-go + protoc-gen-go-grpc) can replace this file with
+// generated code without changing the package path or any call sites.
+package inventoryv1
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// Resource is the gRPC counterpart of the REST ResourceRequest/response body.
+type Resource struct {
+	Id           string `json:"id"`
+	ResourceType string `json:"resource_type"`
+	WorkspaceId  string `json:"workspace_id"`
+	MetadataJson string `json:"metadata_json"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type CreateResourceRequest struct {
+	Resource *Resource `json:"resource"`
+}
+
+type CreateResourceResponse struct {
+	Resource *Resource `json:"resource"`
+}
+
+type GetResourceRequest struct {
+	Id string `json:"id"`
+}
+
+type GetResourceResponse struct {
+	Resource *Resource `json:"resource"`
+}
+
+type ListResourcesRequest struct {
+	ResourceType string `json:"resource_type"`
+	WorkspaceId  string `json:"workspace_id"`
+}
+
+type ListResourcesResponse struct {
+	Resources []*Resource `json:"resources"`
+}
+
+type DeleteResourceRequest struct {
+	Id string `json:"id"`
+}
+
+type DeleteResourceResponse struct{}
+
+type WatchRequest struct {
+	ResourceType string `json:"resource_type"`
+	// StartCursor resumes a previous Watch from the cursor of the last
+	// ResourceChanged the caller observed, so a reconnect doesn't miss
+	// events. Empty starts from the current state.
+	StartCursor string `json:"start_cursor,omitempty"`
+}
+
+// RelationshipChange is the SpiceDB-side half of a ResourceChanged event:
+// a relationship touched or deleted for the resource, as reported by
+// SpiceDB's WatchService.
+type RelationshipChange struct {
+	Relation    string `json:"relation"`
+	SubjectType string `json:"subject_type"`
+	SubjectId   string `json:"subject_id"`
+	Operation   string `json:"operation"` // "touch" or "delete"
+}
+
+type ResourceChanged struct {
+	Op                  string                `json:"op"`
+	Resource            *Resource             `json:"resource"`
+	RelationshipUpdates []*RelationshipChange `json:"relationship_updates,omitempty"`
+	// ZedToken is the SpiceDB revision this event is consistent with, if the
+	// event originated from (or was correlated with) a relationship write.
+	ZedToken string `json:"zed_token,omitempty"`
+	// Cursor resumes a Watch after this event. It is "pg:<seq>" (the
+	// resource_watch_log sequence number) for a Postgres-originated change,
+	// or "zed:<token>" for a SpiceDB-originated one; a single event's cursor
+	// never carries both.
+	Cursor string `json:"cursor"`
+}
+
+// InventoryServiceServer is implemented by the inventory API to serve the
+// gRPC surface alongside the existing REST handlers.
+type InventoryServiceServer interface {
+	CreateResource(context.Context, *CreateResourceRequest) (*CreateResourceResponse, error)
+	GetResource(context.Context, *GetResourceRequest) (*GetResourceResponse, error)
+	ListResources(context.Context, *ListResourcesRequest) (*ListResourcesResponse, error)
+	DeleteResource(context.Context, *DeleteResourceRequest) (*DeleteResourceResponse, error)
+	Watch(*WatchRequest, InventoryService_WatchServer) error
+}
+
+// InventoryService_WatchServer is the server-side stream handle for Watch.
+type InventoryService_WatchServer interface {
+	Send(*ResourceChanged) error
+	grpc.ServerStream
+}
+
+type inventoryServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (s *inventoryServiceWatchServer) Send(m *ResourceChanged) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// ServiceDesc is registered against a *grpc.Server the same way a generated
+// _ServiceDesc would be: via RegisterInventoryServiceServer.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kessel.inventory.v1.InventoryService",
+	HandlerType: (*InventoryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateResource",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(CreateResourceRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(InventoryServiceServer).CreateResource(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.inventory.v1.InventoryService/CreateResource"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(InventoryServiceServer).CreateResource(ctx, req.(*CreateResourceRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "GetResource",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(GetResourceRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(InventoryServiceServer).GetResource(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.inventory.v1.InventoryService/GetResource"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(InventoryServiceServer).GetResource(ctx, req.(*GetResourceRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "ListResources",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(ListResourcesRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(InventoryServiceServer).ListResources(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.inventory.v1.InventoryService/ListResources"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(InventoryServiceServer).ListResources(ctx, req.(*ListResourcesRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "DeleteResource",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(DeleteResourceRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(InventoryServiceServer).DeleteResource(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.inventory.v1.InventoryService/DeleteResource"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(InventoryServiceServer).DeleteResource(ctx, req.(*DeleteResourceRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Watch",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				m := new(WatchRequest)
+				if err := stream.RecvMsg(m); err != nil {
+					return err
+				}
+				return srv.(InventoryServiceServer).Watch(m, &inventoryServiceWatchServer{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kessel/inventory/v1/inventory.proto",
+}
+
+// RegisterInventoryServiceServer registers srv on s, same call shape a
+// generated `RegisterInventoryServiceServer` would have.
+func RegisterInventoryServiceServer(s grpc.ServiceRegistrar, srv InventoryServiceServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
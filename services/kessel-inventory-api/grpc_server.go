@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	inventoryv1 "github.com/akoserwal/kessel-in-a-box/services/kessel-inventory-api/api/kessel/inventory/v1"
+)
+
+// inventoryGRPCServer implements inventoryv1.InventoryServiceServer on top of
+// the same Postgres-backed resources table the REST handlers use.
+type inventoryGRPCServer struct {
+	inventoryv1.InventoryServiceServer
+}
+
+func (s *inventoryGRPCServer) CreateResource(ctx context.Context, req *inventoryv1.CreateResourceRequest) (*inventoryv1.CreateResourceResponse, error) {
+	if req.Resource == nil || req.Resource.Id == "" || req.Resource.ResourceType == "" {
+		return nil, status.Error(codes.InvalidArgument, "resource.id and resource.resource_type are required")
+	}
+
+	res := req.Resource
+	now := time.Now()
+	if err := storeResource(ctx, res.Id, res.ResourceType, res.WorkspaceId, nullableJSON(res.MetadataJson)); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store resource: %v", err)
+	}
+
+	res.CreatedAt = now.Format(time.RFC3339)
+	res.UpdatedAt = now.Format(time.RFC3339)
+	return &inventoryv1.CreateResourceResponse{Resource: res}, nil
+}
+
+func (s *inventoryGRPCServer) GetResource(ctx context.Context, req *inventoryv1.GetResourceRequest) (*inventoryv1.GetResourceResponse, error) {
+	res, err := fetchResource(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, status.Errorf(codes.NotFound, "resource %q not found", req.Id)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "query failed: %v", err)
+	}
+	return &inventoryv1.GetResourceResponse{Resource: res}, nil
+}
+
+func (s *inventoryGRPCServer) ListResources(ctx context.Context, req *inventoryv1.ListResourcesRequest) (*inventoryv1.ListResourcesResponse, error) {
+	resources, err := listResources(ctx, req.ResourceType, req.WorkspaceId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "query failed: %v", err)
+	}
+	return &inventoryv1.ListResourcesResponse{Resources: resources}, nil
+}
+
+func (s *inventoryGRPCServer) DeleteResource(ctx context.Context, req *inventoryv1.DeleteResourceRequest) (*inventoryv1.DeleteResourceResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM resources WHERE id = $1`, req.Id); err != nil {
+		return nil, status.Errorf(codes.Internal, "delete failed: %v", err)
+	}
+	return &inventoryv1.DeleteResourceResponse{}, nil
+}
+
+// Watch streams ResourceChanged events from changeHub: Postgres-originated
+// resource writes and SpiceDB-originated relationship changes, unified (see
+// watch.go). A StartCursor resumes a dropped connection by replaying
+// resource_watch_log and/or relationship_watch_log from that point.
+func (s *inventoryGRPCServer) Watch(req *inventoryv1.WatchRequest, stream inventoryv1.InventoryService_WatchServer) error {
+	ctx := stream.Context()
+	cursor := parseWatchCursor(req.StartCursor)
+
+	id, ch := changeHub.subscribe()
+	defer changeHub.unsubscribe(id)
+
+	if cursor.hasPgSeq {
+		if err := replayResourceLog(ctx, cursor.pgSeq, req.ResourceType, stream.Send); err != nil {
+			return status.Errorf(codes.Internal, "failed to replay resource_watch_log: %v", err)
+		}
+	}
+	if cursor.zedToken != "" {
+		if err := replayRelationshipLog(ctx, cursor.zedToken, req.ResourceType, stream.Send); err != nil {
+			return status.Errorf(codes.Internal, "failed to replay relationship_watch_log: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if req.ResourceType != "" && event.Resource != nil && event.Resource.ResourceType != req.ResourceType && event.Resource.ResourceType != "" {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func fetchResource(ctx context.Context, id string) (*inventoryv1.Resource, error) {
+	var res inventoryv1.Resource
+	var metadataJSON []byte
+	var createdAt time.Time
+	err := db.QueryRowContext(ctx, `
+		SELECT id, resource_type, workspace_id, metadata, created_at
+		FROM resources WHERE id = $1
+	`, id).Scan(&res.Id, &res.ResourceType, &res.WorkspaceId, &metadataJSON, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	res.MetadataJson = string(metadataJSON)
+	res.CreatedAt = createdAt.Format(time.RFC3339)
+	return &res, nil
+}
+
+func listResources(ctx context.Context, resourceType, workspaceID string) ([]*inventoryv1.Resource, error) {
+	query := "SELECT id, resource_type, workspace_id, metadata, created_at, updated_at FROM resources WHERE 1=1"
+	args := []interface{}{}
+	argNum := 1
+
+	if resourceType != "" {
+		query += fmt.Sprintf(" AND resource_type = $%d", argNum)
+		args = append(args, resourceType)
+		argNum++
+	}
+	if workspaceID != "" {
+		query += fmt.Sprintf(" AND workspace_id = $%d", argNum)
+		args = append(args, workspaceID)
+		argNum++
+	}
+	query += " ORDER BY created_at DESC LIMIT 100"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []*inventoryv1.Resource
+	for rows.Next() {
+		var res inventoryv1.Resource
+		var metadataJSON []byte
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&res.Id, &res.ResourceType, &res.WorkspaceId, &metadataJSON, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+		res.MetadataJson = string(metadataJSON)
+		res.CreatedAt = createdAt.Format(time.RFC3339)
+		res.UpdatedAt = updatedAt.Format(time.RFC3339)
+		resources = append(resources, &res)
+	}
+	return resources, nil
+}
+
+func nullableJSON(raw string) []byte {
+	if raw == "" {
+		return []byte("null")
+	}
+	return []byte(raw)
+}
+
+// serveGRPCAndHTTP multiplexes gRPC and the existing HTTP/REST mux on a
+// single listener, routing by content-type the same way grpc-gateway
+// deployments typically share a port without a separate reverse proxy.
+func serveGRPCAndHTTP(addr string, grpcServer *grpc.Server, httpHandler http.Handler) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mixedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+
+	h2s := &http.Server{
+		Addr:    addr,
+		Handler: h2cHandler(mixedHandler),
+	}
+	return h2s.Serve(lis)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cHandler lets the combined gRPC+REST listener accept HTTP/2 cleartext
+// connections (required for gRPC) without terminating TLS in front of it,
+// the same way local/dev grpc-gateway setups avoid a separate proxy.
+func h2cHandler(next http.Handler) http.Handler {
+	return h2c.NewHandler(next, &http2.Server{})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -11,13 +10,16 @@ import (
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"google.golang.org/grpc"
+
+	inventoryv1 "github.com/akoserwal/kessel-in-a-box/services/kessel-inventory-api/api/kessel/inventory/v1"
 )
 
 var (
-	db                   *sql.DB
-	relationsAPIURL      string
-	serverPort           = getEnv("SERVER_PORT", "8000")
+	db              *sql.DB
+	relationsAPIURL string
+	serverPort      = getEnv("SERVER_PORT", "8000")
 )
 
 func getEnv(key, fallback string) string {
@@ -68,20 +70,59 @@ func main() {
 	if err := initSchema(); err != nil {
 		log.Fatalf("Failed to initialize schema: %v", err)
 	}
+	if err := initReplicationSchema(); err != nil {
+		log.Fatalf("Failed to initialize replication schema: %v", err)
+	}
+
+	// Drain the resource_events outbox into the relations API in the
+	// background, so relationship writes survive a crash between the
+	// resources INSERT and the SpiceDB write.
+	workerCtx, cancelWorker := context.WithCancel(context.Background())
+	defer cancelWorker()
+	go newOutboxWorker().Run(workerCtx)
+
+	// Replication: a cron scheduler enqueues sweep jobs for cron-triggered
+	// policies, and a job worker drains both those and the jobs enqueued
+	// per-write by enqueueEventReplicationJobs.
+	go newReplicationCronScheduler().Run(workerCtx)
+	go newReplicationJobWorker().Run(workerCtx)
+
+	// Watch: Postgres LISTEN/NOTIFY feeds resource create/update events,
+	// and (if SPICEDB_ENDPOINT is set) SpiceDB's WatchService feeds
+	// relationship changes. Both land on the same changeHub that backs the
+	// gRPC Watch RPC and the /resources/watch SSE endpoint.
+	go runPostgresChangeListener(workerCtx, connStr)
+	if spicedbEndpoint := getEnv("SPICEDB_ENDPOINT", ""); spicedbEndpoint != "" {
+		watchClient, err := connectSpiceDBWatch(spicedbEndpoint, getEnv("SPICEDB_TOKEN", "testtesttesttest"))
+		if err != nil {
+			log.Printf("Warning: SpiceDB watch disabled: %v", err)
+		} else {
+			go runSpiceDBWatchLoop(workerCtx, watchClient)
+		}
+	}
 
 	// Setup HTTP handlers
 	http.HandleFunc("/health", healthCheckHandler)
 	http.HandleFunc("/livez", healthCheckHandler)
 	http.HandleFunc("/readyz", readyCheckHandler)
 	http.HandleFunc("/api/inventory/v1/resources", resourcesHandler)
+	http.HandleFunc("/api/inventory/v1/resources/watch", resourcesWatchHandler)
 	http.HandleFunc("/api/inventory/v1/resources/", resourceGetHandler)
+	http.HandleFunc("/api/inventory/v1/replication/targets", replicationTargetsHandler)
+	http.HandleFunc("/api/inventory/v1/replication/policies", replicationPoliciesHandler)
+	http.HandleFunc("/api/inventory/v1/replication/jobs", replicationJobsHandler)
+
+	// gRPC server, sharing the same port as the REST handlers above. Forced
+	// onto this server only, so it doesn't affect other gRPC clients in the
+	// process (e.g. the SpiceDB Watch client in watch.go).
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	inventoryv1.RegisterInventoryServiceServer(grpcServer, &inventoryGRPCServer{})
 
-	// Start HTTP server
 	addr := ":" + serverPort
 	log.Printf("Starting kessel-inventory-api (mock) on %s", addr)
-	log.Printf("Endpoints: /api/inventory/v1/resources")
+	log.Printf("Endpoints: /api/inventory/v1/resources (REST), kessel.inventory.v1.InventoryService (gRPC)")
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	if err := serveGRPCAndHTTP(addr, grpcServer, http.DefaultServeMux); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -93,12 +134,89 @@ func initSchema() error {
 		resource_type TEXT NOT NULL,
 		workspace_id TEXT,
 		metadata JSONB,
+		zed_token TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_resources_type ON resources(resource_type);
 	CREATE INDEX IF NOT EXISTS idx_resources_workspace ON resources(workspace_id);
+
+	-- resource_events is a transactional outbox: rows are written in the
+	-- same transaction as the resources upsert they accompany, so a crash
+	-- between "resource stored" and "relationship written to SpiceDB" can't
+	-- lose the relationship write. The background outbox worker drains it.
+	-- A row that exhausts maxAttempts is marked dead rather than deleted, so
+	-- it stays around for operators to inspect instead of silently vanishing.
+	CREATE TABLE IF NOT EXISTS resource_events (
+		id BIGSERIAL PRIMARY KEY,
+		resource_id TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		dead BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_resource_events_next_attempt ON resource_events(next_attempt_at) WHERE NOT dead;
+
+	-- resource_watch_log gives Watch subscribers a durable, replayable
+	-- sequence of resource changes: the trigger below appends to it and
+	-- NOTIFYs resource_changes with just the new seq, so watchers can
+	-- resume a dropped connection by replaying everything after the last
+	-- seq they saw instead of re-scanning the resources table.
+	CREATE TABLE IF NOT EXISTS resource_watch_log (
+		seq BIGSERIAL PRIMARY KEY,
+		resource_id TEXT NOT NULL,
+		op TEXT NOT NULL,
+		resource JSONB NOT NULL,
+		zed_token TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- relationship_watch_log gives Watch subscribers a durable, replayable
+	-- record of SpiceDB-originated relationship changes (see
+	-- runSpiceDBWatchLoop), so a reconnecting client's zed: cursor can
+	-- replay exactly the updates it missed, the same way resource_watch_log
+	-- does for Postgres-originated changes.
+	CREATE TABLE IF NOT EXISTS relationship_watch_log (
+		seq BIGSERIAL PRIMARY KEY,
+		resource_id TEXT NOT NULL,
+		resource_type TEXT NOT NULL,
+		relation TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		subject_type TEXT,
+		subject_id TEXT,
+		zed_token TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_relationship_watch_log_zed_token ON relationship_watch_log(zed_token);
+
+	CREATE OR REPLACE FUNCTION notify_resource_change() RETURNS TRIGGER AS $body$
+	DECLARE
+		v_op TEXT;
+		v_seq BIGINT;
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			v_op := 'create';
+		ELSE
+			v_op := 'update';
+		END IF;
+
+		INSERT INTO resource_watch_log (resource_id, op, resource, zed_token)
+		VALUES (NEW.id, v_op, row_to_json(NEW)::jsonb, NEW.zed_token)
+		RETURNING seq INTO v_seq;
+
+		PERFORM pg_notify('resource_changes', v_seq::text);
+		RETURN NEW;
+	END;
+	$body$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS resources_notify_trigger ON resources;
+	CREATE TRIGGER resources_notify_trigger
+		AFTER INSERT OR UPDATE ON resources
+		FOR EACH ROW EXECUTE FUNCTION notify_resource_change();
 	`
 
 	_, err := db.Exec(schema)
@@ -158,32 +276,13 @@ func createResourceHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Creating resource: %s:%s in workspace %s", req.ResourceType, req.ResourceID, req.WorkspaceID)
 
-	// Store resource in database
 	metadataJSON, _ := json.Marshal(req.Metadata)
-	_, err := db.Exec(`
-		INSERT INTO resources (id, resource_type, workspace_id, metadata, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO UPDATE SET
-			resource_type = EXCLUDED.resource_type,
-			workspace_id = EXCLUDED.workspace_id,
-			metadata = EXCLUDED.metadata,
-			updated_at = EXCLUDED.updated_at
-	`, req.ResourceID, req.ResourceType, req.WorkspaceID, metadataJSON, time.Now(), time.Now())
-
-	if err != nil {
+	if err := storeResource(r.Context(), req.ResourceID, req.ResourceType, req.WorkspaceID, metadataJSON); err != nil {
 		log.Printf("Failed to store resource: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to store resource: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Create relationship in SpiceDB if workspace is specified
-	if req.WorkspaceID != "" {
-		if err := createResourceRelationship(req.ResourceType, req.ResourceID, req.WorkspaceID); err != nil {
-			log.Printf("Warning: Failed to create relationship: %v", err)
-			// Don't fail the request, just log the error
-		}
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -195,42 +294,54 @@ func createResourceHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func createResourceRelationship(resourceType, resourceID, workspaceID string) error {
-	// Create relationship: hbi/host:resourceID#t_workspace@rbac/workspace:workspaceID
-	// According to the schema, hbi/host has a relation TO rbac/workspace (not the other way around)
-	relationshipReq := map[string]string{
-		"resource_type": "hbi/host",
-		"resource_id":   resourceID,
-		"relation":      "t_workspace",
-		"subject_type":  "rbac/workspace",
-		"subject_id":    workspaceID,
-	}
+// storeResource upserts a resource and, if it has a workspace, enqueues the
+// hbi/host -> rbac/workspace relationship write in the same transaction, so
+// the two can never be left inconsistent by a crash (see outbox.go).
+func storeResource(ctx context.Context, id, resourceType, workspaceID string, metadataJSON []byte) error {
+	now := time.Now()
 
-	reqBody, _ := json.Marshal(relationshipReq)
-	req, err := http.NewRequest("POST", relationsAPIURL+"/v1/relationships", bytes.NewBuffer(reqBody))
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer tx.Rollback()
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO resources (id, resource_type, workspace_id, metadata, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			resource_type = EXCLUDED.resource_type,
+			workspace_id = EXCLUDED.workspace_id,
+			metadata = EXCLUDED.metadata,
+			updated_at = EXCLUDED.updated_at
+	`, id, resourceType, workspaceID, metadataJSON, now, now); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("relations API returned status %d", resp.StatusCode)
+	if workspaceID != "" {
+		if err := enqueueWorkspaceRelationship(tx, id, workspaceID); err != nil {
+			return fmt.Errorf("failed to enqueue relationship event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	log.Printf("Created relationship: hbi/host:%s#t_workspace@rbac/workspace:%s", resourceID, workspaceID)
+	// Best-effort: a failure to enqueue a replication job shouldn't fail the
+	// write that triggered it.
+	if err := enqueueEventReplicationJobs(ctx, id, resourceType); err != nil {
+		log.Printf("Warning: failed to enqueue replication jobs for resource %s: %v", id, err)
+	}
 	return nil
 }
 
 func listResourcesHandler(w http.ResponseWriter, r *http.Request) {
 	resourceType := r.URL.Query().Get("resource_type")
 	workspaceID := r.URL.Query().Get("workspace_id")
+	permission := r.URL.Query().Get("permission")
+	subjectType := r.URL.Query().Get("subject_type")
+	subjectID := r.URL.Query().Get("subject_id")
 
 	query := "SELECT id, resource_type, workspace_id, metadata, created_at FROM resources WHERE 1=1"
 	args := []interface{}{}
@@ -248,6 +359,32 @@ func listResourcesHandler(w http.ResponseWriter, r *http.Request) {
 		argNum++
 	}
 
+	// permission+subject_type+subject_id filters the listing to resources the
+	// subject can actually access per SpiceDB, rather than relying solely on
+	// the workspace_id column (which a caller may not even know).
+	if permission != "" && subjectType != "" && subjectID != "" {
+		permittedType := resourceType
+		if permittedType == "" {
+			permittedType = "hbi/host"
+		}
+		permittedIDs, err := lookupPermittedResourceIDs(r.Context(), permittedType, permission, subjectType, subjectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Permission lookup failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(permittedIDs) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"resources": []map[string]interface{}{},
+				"count":     0,
+			})
+			return
+		}
+		query += fmt.Sprintf(" AND id = ANY($%d)", argNum)
+		args = append(args, pq.Array(permittedIDs))
+		argNum++
+	}
+
 	query += " ORDER BY created_at DESC LIMIT 100"
 
 	rows, err := db.Query(query, args...)
@@ -296,12 +433,13 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request) {
 
 	var id, resType, workspaceID string
 	var metadataJSON []byte
+	var zedToken sql.NullString
 	var createdAt time.Time
 
 	err := db.QueryRow(`
-		SELECT id, resource_type, workspace_id, metadata, created_at
+		SELECT id, resource_type, workspace_id, metadata, zed_token, created_at
 		FROM resources WHERE id = $1
-	`, resourceID).Scan(&id, &resType, &workspaceID, &metadataJSON, &createdAt)
+	`, resourceID).Scan(&id, &resType, &workspaceID, &metadataJSON, &zedToken, &createdAt)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, "Resource not found", http.StatusNotFound)
@@ -315,12 +453,34 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request) {
 	var metadata map[string]interface{}
 	json.Unmarshal(metadataJSON, &metadata)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	result := map[string]interface{}{
 		"id":            id,
 		"resource_type": resType,
 		"workspace_id":  workspaceID,
 		"metadata":      metadata,
 		"created_at":    createdAt.Format(time.RFC3339),
-	})
+	}
+
+	// permission/subject_type/subject_id, if all supplied, ask the relations
+	// API whether the subject can access this resource, passing the
+	// resource's own zed_token as at_least_as_fresh so the check doesn't pay
+	// for FullyConsistent when a revision this fresh already suffices.
+	permission := r.URL.Query().Get("permission")
+	subjectType := r.URL.Query().Get("subject_type")
+	subjectID := r.URL.Query().Get("subject_id")
+	if permission != "" && subjectType != "" && subjectID != "" {
+		allowed, err := checkResourcePermission(r.Context(), resType, id, permission, subjectType, subjectID, zedToken.String)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Permission check failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		result["permitted"] = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
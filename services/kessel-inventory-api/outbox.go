@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// relationshipPayload is what gets persisted into resource_events and later
+// replayed against the relations API. It mirrors the body
+// createResourceRelationship used to POST directly before the outbox existed.
+type relationshipPayload struct {
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Relation     string `json:"relation"`
+	SubjectType  string `json:"subject_type"`
+	SubjectID    string `json:"subject_id"`
+}
+
+// enqueueWorkspaceRelationship writes the outbox row for a resource's
+// workspace relationship in the same transaction as the resources row, so
+// the relationship write can never be lost even if the process crashes
+// immediately after the HTTP response is sent.
+func enqueueWorkspaceRelationship(tx *sql.Tx, resourceID, workspaceID string) error {
+	payload, err := json.Marshal(relationshipPayload{
+		ResourceType: "hbi/host",
+		ResourceID:   resourceID,
+		Relation:     "t_workspace",
+		SubjectType:  "rbac/workspace",
+		SubjectID:    workspaceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal relationship payload: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO resource_events (resource_id, payload, next_attempt_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+	`, resourceID, payload)
+	return err
+}
+
+// outboxWorker drains resource_events into the relations API, storing the
+// ZedToken each write returns back onto the originating resource row so
+// reads can later request AtLeastAsFresh consistency instead of paying for
+// FullyConsistent on every check.
+type outboxWorker struct {
+	pollInterval time.Duration
+	maxAttempts  int
+	client       *http.Client
+}
+
+func newOutboxWorker() *outboxWorker {
+	return &outboxWorker{
+		pollInterval: 2 * time.Second,
+		maxAttempts:  10,
+		client:       &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Run polls resource_events until ctx is canceled, draining due events one
+// at a time. It's intentionally simple (no batching, no SKIP LOCKED) to match
+// the rest of this service's single-replica, best-effort mock semantics.
+func (w *outboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.drainOnce(ctx)
+		}
+	}
+}
+
+func (w *outboxWorker) drainOnce(ctx context.Context) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, resource_id, payload, attempts
+		FROM resource_events
+		WHERE NOT dead AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY id
+		LIMIT 50
+	`)
+	if err != nil {
+		log.Printf("outbox: failed to query due events: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type event struct {
+		id         int64
+		resourceID string
+		payload    []byte
+		attempts   int
+	}
+
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.resourceID, &e.payload, &e.attempts); err != nil {
+			log.Printf("outbox: failed to scan event: %v", err)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	for _, e := range events {
+		zedToken, err := w.publish(ctx, e.payload)
+		if err != nil {
+			w.handleFailure(ctx, e.id, e.attempts, err)
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, `DELETE FROM resource_events WHERE id = $1`, e.id); err != nil {
+			log.Printf("outbox: failed to delete drained event %d: %v", e.id, err)
+		}
+
+		if zedToken != "" {
+			if _, err := db.ExecContext(ctx, `UPDATE resources SET zed_token = $1 WHERE id = $2`, zedToken, e.resourceID); err != nil {
+				log.Printf("outbox: failed to store zed_token for resource %s: %v", e.resourceID, err)
+			}
+		}
+	}
+}
+
+func (w *outboxWorker) publish(ctx context.Context, payload []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, relationsAPIURL+"/v1/relationships", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("relations API returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		WrittenAt string `json:"written_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", nil
+	}
+	return body.WrittenAt, nil
+}
+
+func (w *outboxWorker) handleFailure(ctx context.Context, eventID int64, attempts int, publishErr error) {
+	attempts++
+	if attempts >= w.maxAttempts {
+		log.Printf("outbox: event %d exceeded max attempts (%d), marking dead: %v", eventID, w.maxAttempts, publishErr)
+		if _, err := db.ExecContext(ctx, `
+			UPDATE resource_events SET attempts = $1, dead = TRUE
+			WHERE id = $2
+		`, attempts, eventID); err != nil {
+			log.Printf("outbox: failed to mark event %d dead: %v", eventID, err)
+		}
+		return
+	}
+
+	log.Printf("outbox: event %d failed (attempt %d/%d): %v", eventID, attempts, w.maxAttempts, publishErr)
+
+	backoff := time.Duration(attempts) * time.Second
+	if backoff > time.Minute {
+		backoff = time.Minute
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		UPDATE resource_events SET attempts = $1, next_attempt_at = CURRENT_TIMESTAMP + $2::interval
+		WHERE id = $3
+	`, attempts, fmt.Sprintf("%d seconds", int(backoff.Seconds())), eventID); err != nil {
+		log.Printf("outbox: failed to reschedule event %d: %v", eventID, err)
+	}
+}
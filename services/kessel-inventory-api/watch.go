@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/grpcutil"
+	"github.com/lib/pq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	inventoryv1 "github.com/akoserwal/kessel-in-a-box/services/kessel-inventory-api/api/kessel/inventory/v1"
+)
+
+// This file feeds the Watch RPC and the /resources/watch SSE endpoint from
+// two sources, unified into a single resourceChangeHub:
+//
+//   - Postgres LISTEN/NOTIFY on the resources table (via a trigger that also
+//     appends to resource_watch_log, giving each change a durable, replayable
+//     sequence number).
+//   - SpiceDB's WatchService, for relationship changes that didn't originate
+//     from this instance's own writes (e.g. a relationship edited directly,
+//     or replicated in from elsewhere).
+//
+// This mirrors the pattern spicedb-kubeapi-proxy uses to keep a local cache
+// synchronized with SpiceDB, extended with the Postgres side this service
+// also owns.
+
+// resourceChangeHub fans a single stream of ResourceChanged events out to
+// every active watcher (gRPC or SSE).
+type resourceChangeHub struct {
+	mu   sync.Mutex
+	subs map[int]chan *inventoryv1.ResourceChanged
+	next int
+}
+
+func newResourceChangeHub() *resourceChangeHub {
+	return &resourceChangeHub{subs: map[int]chan *inventoryv1.ResourceChanged{}}
+}
+
+func (h *resourceChangeHub) subscribe() (int, chan *inventoryv1.ResourceChanged) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.next
+	h.next++
+	ch := make(chan *inventoryv1.ResourceChanged, 32)
+	h.subs[id] = ch
+	return id, ch
+}
+
+func (h *resourceChangeHub) unsubscribe(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ch, ok := h.subs[id]; ok {
+		delete(h.subs, id)
+		close(ch)
+	}
+}
+
+// publish drops the event for any subscriber whose channel is full rather
+// than blocking: a slow watcher shouldn't stall writes for everyone else. It
+// can still catch up via the replayable resource_watch_log.
+func (h *resourceChangeHub) publish(event *inventoryv1.ResourceChanged) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("watch: subscriber channel full, dropping event for resource %v", event.Resource)
+		}
+	}
+}
+
+var changeHub = newResourceChangeHub()
+
+// watchCursor is the parsed form of ResourceChanged.Cursor / WatchRequest's
+// start_cursor: a Postgres resource_watch_log sequence number, a SpiceDB zed
+// token, or both, joined with ";" (e.g. "pg:42;zed:GhUKEzE...").
+type watchCursor struct {
+	pgSeq    int64
+	hasPgSeq bool
+	zedToken string
+}
+
+func parseWatchCursor(raw string) watchCursor {
+	var c watchCursor
+	for _, part := range strings.Split(raw, ";") {
+		switch {
+		case strings.HasPrefix(part, "pg:"):
+			if seq, err := strconv.ParseInt(strings.TrimPrefix(part, "pg:"), 10, 64); err == nil {
+				c.pgSeq = seq
+				c.hasPgSeq = true
+			}
+		case strings.HasPrefix(part, "zed:"):
+			c.zedToken = strings.TrimPrefix(part, "zed:")
+		}
+	}
+	return c
+}
+
+// resourceWatchLogRow mirrors row_to_json(NEW) as inserted by the
+// notify_resource_change trigger (see initReplicationSchema's sibling,
+// initSchema, for the trigger definition).
+type resourceWatchLogRow struct {
+	Id           string                 `json:"id"`
+	ResourceType string                 `json:"resource_type"`
+	WorkspaceId  string                 `json:"workspace_id"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	ZedToken     *string                `json:"zed_token"`
+	CreatedAt    string                 `json:"created_at"`
+	UpdatedAt    string                 `json:"updated_at"`
+}
+
+func resourceFromWatchLogJSON(raw []byte) (*inventoryv1.Resource, error) {
+	var row resourceWatchLogRow
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+	metadataJSON, _ := json.Marshal(row.Metadata)
+	return &inventoryv1.Resource{
+		Id:           row.Id,
+		ResourceType: row.ResourceType,
+		WorkspaceId:  row.WorkspaceId,
+		MetadataJson: string(metadataJSON),
+		CreatedAt:    row.CreatedAt,
+		UpdatedAt:    row.UpdatedAt,
+	}, nil
+}
+
+// replayResourceLog sends every resource_watch_log entry after `since` to
+// send, oldest first, so a reconnecting watcher doesn't miss writes that
+// happened while it was disconnected.
+func replayResourceLog(ctx context.Context, since int64, resourceType string, send func(*inventoryv1.ResourceChanged) error) error {
+	query := "SELECT seq, op, resource, COALESCE(zed_token, '') FROM resource_watch_log WHERE seq > $1"
+	args := []interface{}{since}
+	if resourceType != "" {
+		query += " AND resource->>'resource_type' = $2"
+		args = append(args, resourceType)
+	}
+	query += " ORDER BY seq"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seq int64
+		var op, zedToken string
+		var resourceJSON []byte
+		if err := rows.Scan(&seq, &op, &resourceJSON, &zedToken); err != nil {
+			continue
+		}
+		res, err := resourceFromWatchLogJSON(resourceJSON)
+		if err != nil {
+			continue
+		}
+		if err := send(&inventoryv1.ResourceChanged{
+			Op:       op,
+			Resource: res,
+			ZedToken: zedToken,
+			Cursor:   fmt.Sprintf("pg:%d", seq),
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// replayRelationshipLog sends every relationship_watch_log entry after the
+// one matching sinceZedToken to send, oldest first, mirroring
+// replayResourceLog but for SpiceDB-originated relationship changes. An
+// empty or unrecognized sinceZedToken replays the whole log, since there's
+// no better starting point to resume from in that case.
+func replayRelationshipLog(ctx context.Context, sinceZedToken, resourceType string, send func(*inventoryv1.ResourceChanged) error) error {
+	var sinceSeq int64
+	if sinceZedToken != "" {
+		err := db.QueryRowContext(ctx, `SELECT seq FROM relationship_watch_log WHERE zed_token = $1`, sinceZedToken).Scan(&sinceSeq)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	query := "SELECT resource_id, resource_type, relation, operation, subject_type, subject_id, zed_token FROM relationship_watch_log WHERE seq > $1"
+	args := []interface{}{sinceSeq}
+	if resourceType != "" {
+		query += " AND resource_type = $2"
+		args = append(args, resourceType)
+	}
+	query += " ORDER BY seq"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var resourceID, resType, relation, operation, zedToken string
+		var subjectType, subjectID sql.NullString
+		if err := rows.Scan(&resourceID, &resType, &relation, &operation, &subjectType, &subjectID, &zedToken); err != nil {
+			continue
+		}
+		if err := send(&inventoryv1.ResourceChanged{
+			Op:       "relationship",
+			Resource: &inventoryv1.Resource{Id: resourceID, ResourceType: resType},
+			RelationshipUpdates: []*inventoryv1.RelationshipChange{{
+				Relation:    relation,
+				Operation:   operation,
+				SubjectType: subjectType.String,
+				SubjectId:   subjectID.String,
+			}},
+			ZedToken: zedToken,
+			Cursor:   fmt.Sprintf("zed:%s", zedToken),
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// runPostgresChangeListener subscribes to the resource_changes NOTIFY
+// channel and republishes every notification onto changeHub. The notify
+// payload is just the resource_watch_log sequence number; the row itself is
+// fetched separately so the notification stays small regardless of
+// resource size.
+func runPostgresChangeListener(ctx context.Context, connStr string) {
+	listener := pq.NewListener(connStr, 2*time.Second, 30*time.Second, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("watch: postgres listener event: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen("resource_changes"); err != nil {
+		log.Printf("watch: failed to LISTEN resource_changes: %v", err)
+		return
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				continue
+			}
+			seq, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				log.Printf("watch: invalid resource_changes payload %q: %v", n.Extra, err)
+				continue
+			}
+			if err := replayResourceLog(ctx, seq-1, "", func(event *inventoryv1.ResourceChanged) error {
+				changeHub.publish(event)
+				return nil
+			}); err != nil {
+				log.Printf("watch: failed to load resource_watch_log seq %d: %v", seq, err)
+			}
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// connectSpiceDBWatch dials SpiceDB purely for its WatchService, so this
+// service can learn about relationship changes it didn't make itself.
+// Unlike kessel-relations-api, it only supports a remote endpoint: watching
+// makes sense against whichever instance is the source of truth, and
+// embedding a second full SpiceDB server here just to watch it would be
+// pointless.
+func connectSpiceDBWatch(endpoint, token string) (v1.WatchServiceClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPICEDB_ENDPOINT %q: %w", endpoint, err)
+	}
+
+	remoteEndpoint := endpoint
+	dialOpts := []grpc.DialOption{grpcutil.WithInsecureBearerToken(token)}
+	switch u.Scheme {
+	case "grpcs":
+		remoteEndpoint = u.Host
+		creds, err := grpcutil.WithSystemCerts(grpcutil.VerifyCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system CA certs: %w", err)
+		}
+		dialOpts = append(dialOpts, creds)
+	case "grpc":
+		remoteEndpoint = u.Host
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	default:
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := grpc.NewClient(remoteEndpoint, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial SpiceDB for watch: %w", err)
+	}
+	return v1.NewWatchServiceClient(conn), nil
+}
+
+// runSpiceDBWatchLoop streams SpiceDB relationship changes for hbi/host
+// resources and republishes them onto changeHub, reconnecting (and resuming
+// from the last ChangesThrough token) on any stream error.
+func runSpiceDBWatchLoop(ctx context.Context, client v1.WatchServiceClient) {
+	var cursor string
+	for ctx.Err() == nil {
+		req := &v1.WatchRequest{OptionalObjectTypes: []string{"hbi/host"}}
+		if cursor != "" {
+			req.OptionalStartCursor = &v1.ZedToken{Token: cursor}
+		}
+
+		stream, err := client.Watch(ctx, req)
+		if err != nil {
+			log.Printf("watch: failed to start SpiceDB watch stream: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("watch: SpiceDB watch stream ended, reconnecting: %v", err)
+				}
+				break
+			}
+			if resp.ChangesThrough != nil {
+				cursor = resp.ChangesThrough.Token
+			}
+			for _, update := range resp.Updates {
+				publishRelationshipUpdate(ctx, update, cursor)
+			}
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func publishRelationshipUpdate(ctx context.Context, update *v1.RelationshipUpdate, zedToken string) {
+	rel := update.Relationship
+	if rel == nil || rel.Resource == nil || rel.Resource.ObjectType != "hbi/host" {
+		return
+	}
+
+	op := "touch"
+	if update.Operation == v1.RelationshipUpdate_OPERATION_DELETE {
+		op = "delete"
+	}
+
+	change := &inventoryv1.RelationshipChange{
+		Relation:  rel.Relation,
+		Operation: op,
+	}
+	if rel.Subject != nil && rel.Subject.Object != nil {
+		change.SubjectType = rel.Subject.Object.ObjectType
+		change.SubjectId = rel.Subject.Object.ObjectId
+	}
+
+	// Persisted before publish so a client that reconnects with the cursor
+	// handed out below can always replay it via replayRelationshipLog, even
+	// if it disconnects immediately after receiving this event.
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO relationship_watch_log (resource_id, resource_type, relation, operation, subject_type, subject_id, zed_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, rel.Resource.ObjectId, rel.Resource.ObjectType, rel.Relation, op, change.SubjectType, change.SubjectId, zedToken); err != nil {
+		log.Printf("watch: failed to persist relationship_watch_log entry: %v", err)
+	}
+
+	changeHub.publish(&inventoryv1.ResourceChanged{
+		Op:                  "relationship",
+		Resource:            &inventoryv1.Resource{Id: rel.Resource.ObjectId, ResourceType: rel.Resource.ObjectType},
+		RelationshipUpdates: []*inventoryv1.RelationshipChange{change},
+		ZedToken:            zedToken,
+		Cursor:              fmt.Sprintf("zed:%s", zedToken),
+	})
+}
+
+// resourcesWatchHandler streams ResourceChanged events as server-sent
+// events. A start_cursor query param resumes from a previous connection:
+// its Postgres component is replayed from resource_watch_log before
+// switching to live events.
+func resourcesWatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	resourceType := r.URL.Query().Get("resource_type")
+	cursor := parseWatchCursor(r.URL.Query().Get("start_cursor"))
+
+	id, ch := changeHub.subscribe()
+	defer changeHub.unsubscribe(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event *inventoryv1.ResourceChanged) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", event.Cursor, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if cursor.hasPgSeq {
+		if err := replayResourceLog(r.Context(), cursor.pgSeq, resourceType, send); err != nil {
+			log.Printf("watch: failed to replay resource_watch_log: %v", err)
+			return
+		}
+	}
+	if cursor.zedToken != "" {
+		if err := replayRelationshipLog(r.Context(), cursor.zedToken, resourceType, send); err != nil {
+			log.Printf("watch: failed to replay relationship_watch_log: %v", err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if resourceType != "" && event.Resource != nil && event.Resource.ResourceType != resourceType && event.Resource.ResourceType != "" {
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		}
+	}
+}
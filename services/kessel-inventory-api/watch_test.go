@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestParseWatchCursor(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want watchCursor
+	}{
+		{
+			name: "empty cursor",
+			raw:  "",
+			want: watchCursor{},
+		},
+		{
+			name: "pg sequence only",
+			raw:  "pg:42",
+			want: watchCursor{pgSeq: 42, hasPgSeq: true},
+		},
+		{
+			name: "zed token only",
+			raw:  "zed:GhUKEzE",
+			want: watchCursor{zedToken: "GhUKEzE"},
+		},
+		{
+			name: "both joined with a semicolon",
+			raw:  "pg:42;zed:GhUKEzE",
+			want: watchCursor{pgSeq: 42, hasPgSeq: true, zedToken: "GhUKEzE"},
+		},
+		{
+			name: "malformed pg sequence is ignored",
+			raw:  "pg:not-a-number",
+			want: watchCursor{},
+		},
+		{
+			name: "unrecognized segment is ignored",
+			raw:  "bogus:1",
+			want: watchCursor{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseWatchCursor(tt.raw)
+			if got != tt.want {
+				t.Errorf("parseWatchCursor(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
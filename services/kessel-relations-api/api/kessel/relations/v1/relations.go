@@ -0,0 +1,234 @@
+// Package relationsv1 is the typed contract for RelationsService, mirroring
+// proto/kessel/relations/v1/relations.proto and the shape of SpiceDB's
+// authzed.api.v1.PermissionsService. A future `make proto` pass (protoc +
+// protoc-gen-go + protoc-gen-go-grpc) can replace this file with generated
+// code without changing the package path or any call sites.
+package relationsv1
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type RelationshipUpdateOperation int32
+
+const (
+	OperationUnspecified RelationshipUpdateOperation = 0
+	OperationCreate      RelationshipUpdateOperation = 1
+	OperationTouch       RelationshipUpdateOperation = 2
+	OperationDelete      RelationshipUpdateOperation = 3
+)
+
+type Permissionship int32
+
+const (
+	PermissionshipUnspecified   Permissionship = 0
+	PermissionshipNoPermission  Permissionship = 1
+	PermissionshipHasPermission Permissionship = 2
+)
+
+type ObjectReference struct {
+	ObjectType string `json:"object_type"`
+	ObjectId   string `json:"object_id"`
+}
+
+type SubjectReference struct {
+	Object           *ObjectReference `json:"object"`
+	OptionalRelation string           `json:"optional_relation,omitempty"`
+}
+
+type Relationship struct {
+	Resource *ObjectReference  `json:"resource"`
+	Relation string            `json:"relation"`
+	Subject  *SubjectReference `json:"subject"`
+}
+
+type RelationshipUpdate struct {
+	Operation    RelationshipUpdateOperation `json:"operation"`
+	Relationship *Relationship               `json:"relationship"`
+}
+
+type WriteRelationshipsRequest struct {
+	Updates []*RelationshipUpdate `json:"updates"`
+}
+
+type WriteRelationshipsResponse struct {
+	WrittenAt string `json:"written_at"`
+}
+
+type ReadRelationshipsRequest struct {
+	ResourceFilter *ObjectReference `json:"resource_filter"`
+}
+
+type ReadRelationshipsResponse struct {
+	Relationship *Relationship `json:"relationship"`
+}
+
+type CheckPermissionRequest struct {
+	Resource               *ObjectReference  `json:"resource"`
+	Permission             string            `json:"permission"`
+	Subject                *SubjectReference `json:"subject"`
+	AtLeastAsFreshZedToken string            `json:"at_least_as_fresh_zed_token,omitempty"`
+}
+
+type CheckPermissionResponse struct {
+	Permissionship Permissionship `json:"permissionship"`
+	CheckedAt      string         `json:"checked_at"`
+}
+
+type CheckBulkPermissionsRequestItem struct {
+	Resource   *ObjectReference  `json:"resource"`
+	Permission string            `json:"permission"`
+	Subject    *SubjectReference `json:"subject"`
+}
+
+type CheckBulkPermissionsResponseItem struct {
+	Request        *CheckBulkPermissionsRequestItem `json:"request"`
+	Permissionship Permissionship                   `json:"permissionship"`
+	Error          string                           `json:"error,omitempty"`
+}
+
+type CheckBulkPermissionsRequest struct {
+	Items                  []*CheckBulkPermissionsRequestItem `json:"items"`
+	AtLeastAsFreshZedToken string                             `json:"at_least_as_fresh_zed_token,omitempty"`
+}
+
+type CheckBulkPermissionsResponse struct {
+	CheckedAt string                              `json:"checked_at"`
+	Results   []*CheckBulkPermissionsResponseItem `json:"results"`
+}
+
+type LookupResourcesRequest struct {
+	ResourceType string            `json:"resource_type"`
+	Permission   string            `json:"permission"`
+	Subject      *SubjectReference `json:"subject"`
+}
+
+type LookupResourcesResponse struct {
+	ResourceId     string         `json:"resource_id"`
+	Permissionship Permissionship `json:"permissionship"`
+}
+
+// RelationsServiceServer is implemented by the relations API to serve the
+// gRPC surface alongside the existing REST handlers.
+type RelationsServiceServer interface {
+	WriteRelationships(context.Context, *WriteRelationshipsRequest) (*WriteRelationshipsResponse, error)
+	ReadRelationships(*ReadRelationshipsRequest, RelationsService_ReadRelationshipsServer) error
+	CheckPermission(context.Context, *CheckPermissionRequest) (*CheckPermissionResponse, error)
+	CheckBulkPermissions(context.Context, *CheckBulkPermissionsRequest) (*CheckBulkPermissionsResponse, error)
+	LookupResources(*LookupResourcesRequest, RelationsService_LookupResourcesServer) error
+}
+
+type RelationsService_ReadRelationshipsServer interface {
+	Send(*ReadRelationshipsResponse) error
+	grpc.ServerStream
+}
+
+type RelationsService_LookupResourcesServer interface {
+	Send(*LookupResourcesResponse) error
+	grpc.ServerStream
+}
+
+type relationsServiceReadRelationshipsServer struct{ grpc.ServerStream }
+
+func (s *relationsServiceReadRelationshipsServer) Send(m *ReadRelationshipsResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+type relationsServiceLookupResourcesServer struct{ grpc.ServerStream }
+
+func (s *relationsServiceLookupResourcesServer) Send(m *LookupResourcesResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// ServiceDesc is registered against a *grpc.Server the same way a generated
+// _ServiceDesc would be: via RegisterRelationsServiceServer.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kessel.relations.v1.RelationsService",
+	HandlerType: (*RelationsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "WriteRelationships",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(WriteRelationshipsRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(RelationsServiceServer).WriteRelationships(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.relations.v1.RelationsService/WriteRelationships"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RelationsServiceServer).WriteRelationships(ctx, req.(*WriteRelationshipsRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "CheckPermission",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(CheckPermissionRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(RelationsServiceServer).CheckPermission(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.relations.v1.RelationsService/CheckPermission"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RelationsServiceServer).CheckPermission(ctx, req.(*CheckPermissionRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "CheckBulkPermissions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(CheckBulkPermissionsRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(RelationsServiceServer).CheckBulkPermissions(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/kessel.relations.v1.RelationsService/CheckBulkPermissions"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RelationsServiceServer).CheckBulkPermissions(ctx, req.(*CheckBulkPermissionsRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ReadRelationships",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				m := new(ReadRelationshipsRequest)
+				if err := stream.RecvMsg(m); err != nil {
+					return err
+				}
+				return srv.(RelationsServiceServer).ReadRelationships(m, &relationsServiceReadRelationshipsServer{stream})
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "LookupResources",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				m := new(LookupResourcesRequest)
+				if err := stream.RecvMsg(m); err != nil {
+					return err
+				}
+				return srv.(RelationsServiceServer).LookupResources(m, &relationsServiceLookupResourcesServer{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kessel/relations/v1/relations.proto",
+}
+
+// RegisterRelationsServiceServer registers srv on s, same call shape a
+// generated `RegisterRelationsServiceServer` would have.
+func RegisterRelationsServiceServer(s grpc.ServiceRegistrar, srv RelationsServiceServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// RelationshipUpdateItem is one entry of a batch relationshipsHandler body.
+// Operation defaults to "touch" (upsert) when omitted, matching the
+// semantics the old single-relationship body had before batching existed.
+type RelationshipUpdateItem struct {
+	Operation    string `json:"operation,omitempty"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Relation     string `json:"relation"`
+	SubjectType  string `json:"subject_type"`
+	SubjectID    string `json:"subject_id"`
+}
+
+func (item RelationshipUpdateItem) toSpiceDBUpdate() (*v1.RelationshipUpdate, error) {
+	op, err := parseRelationshipOperation(item.Operation)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.RelationshipUpdate{
+		Operation: op,
+		Relationship: &v1.Relationship{
+			Resource: &v1.ObjectReference{
+				ObjectType: item.ResourceType,
+				ObjectId:   item.ResourceID,
+			},
+			Relation: item.Relation,
+			Subject: &v1.SubjectReference{
+				Object: &v1.ObjectReference{
+					ObjectType: item.SubjectType,
+					ObjectId:   item.SubjectID,
+				},
+			},
+		},
+	}, nil
+}
+
+func parseRelationshipOperation(op string) (v1.RelationshipUpdate_Operation, error) {
+	switch op {
+	case "", "touch":
+		return v1.RelationshipUpdate_OPERATION_TOUCH, nil
+	case "create":
+		return v1.RelationshipUpdate_OPERATION_CREATE, nil
+	case "delete":
+		return v1.RelationshipUpdate_OPERATION_DELETE, nil
+	default:
+		return 0, fmt.Errorf("unknown operation %q", op)
+	}
+}
+
+// CheckBulkPermissionsRequest mirrors SpiceDB's CheckBulkPermissions, which
+// runs a list of independent permission checks in a single round-trip
+// instead of one HTTP+gRPC call per check.
+type CheckBulkPermissionsRequest struct {
+	Items []CheckPermissionRequest `json:"items"`
+}
+
+type CheckBulkPermissionsResultItem struct {
+	ResourceType   string `json:"resource_type"`
+	ResourceID     string `json:"resource_id"`
+	Permission     string `json:"permission"`
+	SubjectType    string `json:"subject_type"`
+	SubjectID      string `json:"subject_id"`
+	Permissionship string `json:"permissionship"`
+	Error          string `json:"error,omitempty"`
+}
+
+type CheckBulkPermissionsResponse struct {
+	CheckedAt string                           `json:"checked_at"`
+	Results   []CheckBulkPermissionsResultItem `json:"results"`
+}
+
+func checkBulkPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CheckBulkPermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "items must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	// CheckBulkPermissions takes a single Consistency for the whole batch, so
+	// mixed at_least_as_fresh values across items can't be honored correctly
+	// for all of them at once. Reject rather than silently applying item 0's
+	// value to every other item.
+	atLeastAsFresh := req.Items[0].AtLeastAsFresh
+	for _, item := range req.Items[1:] {
+		if item.AtLeastAsFresh != atLeastAsFresh {
+			http.Error(w, "all items must share the same at_least_as_fresh value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	items := make([]*v1.CheckBulkPermissionsRequestItem, 0, len(req.Items))
+	for _, check := range req.Items {
+		items = append(items, &v1.CheckBulkPermissionsRequestItem{
+			Resource: &v1.ObjectReference{
+				ObjectType: check.ResourceType,
+				ObjectId:   check.ResourceID,
+			},
+			Permission: check.Permission,
+			Subject: &v1.SubjectReference{
+				Object: &v1.ObjectReference{
+					ObjectType: check.SubjectType,
+					ObjectId:   check.SubjectID,
+				},
+			},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := spicedbClient.CheckBulkPermissions(ctx, &v1.CheckBulkPermissionsRequest{
+		Consistency: checkConsistency(atLeastAsFresh),
+		Items:       items,
+	})
+	if err != nil {
+		log.Printf("Failed to check bulk permissions: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to check bulk permissions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]CheckBulkPermissionsResultItem, len(resp.Pairs))
+	for i, pair := range resp.Pairs {
+		result := CheckBulkPermissionsResultItem{
+			ResourceType: pair.Request.Resource.ObjectType,
+			ResourceID:   pair.Request.Resource.ObjectId,
+			Permission:   pair.Request.Permission,
+			SubjectType:  pair.Request.Subject.Object.ObjectType,
+			SubjectID:    pair.Request.Subject.Object.ObjectId,
+		}
+		switch outcome := pair.Response.(type) {
+		case *v1.CheckBulkPermissionsPair_Item:
+			result.Permissionship = outcome.Item.Permissionship.String()
+		case *v1.CheckBulkPermissionsPair_Error:
+			result.Error = outcome.Error.GetMessage()
+		}
+		results[i] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CheckBulkPermissionsResponse{
+		CheckedAt: resp.CheckedAt.String(),
+		Results:   results,
+	})
+}
+
+// ReadRelationshipsFilterRequest lets callers list relationships matching a
+// resource and/or subject filter, instead of only being able to write them.
+type ReadRelationshipsFilterRequest struct {
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	Relation     string `json:"relation,omitempty"`
+	SubjectType  string `json:"subject_type,omitempty"`
+	SubjectID    string `json:"subject_id,omitempty"`
+}
+
+func relationshipsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReadRelationshipsFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.ResourceType == "" {
+		http.Error(w, "resource_type is required", http.StatusBadRequest)
+		return
+	}
+
+	filter := &v1.RelationshipFilter{
+		ResourceType:       req.ResourceType,
+		OptionalResourceId: req.ResourceID,
+		OptionalRelation:   req.Relation,
+	}
+	if req.SubjectType != "" {
+		filter.OptionalSubjectFilter = &v1.SubjectFilter{
+			SubjectType:       req.SubjectType,
+			OptionalSubjectId: req.SubjectID,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli, err := spicedbClient.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+		Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		RelationshipFilter: filter,
+	})
+	if err != nil {
+		log.Printf("Failed to read relationships: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to read relationships: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var found []RelationshipRequest
+	for {
+		resp, err := cli.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to stream relationships: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to stream relationships: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rel := resp.Relationship
+		found = append(found, RelationshipRequest{
+			ResourceType: rel.Resource.ObjectType,
+			ResourceID:   rel.Resource.ObjectId,
+			Relation:     rel.Relation,
+			SubjectType:  rel.Subject.Object.ObjectType,
+			SubjectID:    rel.Subject.Object.ObjectId,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"relationships": found})
+}
+
+// LookupResourcesRequest finds every resource of a type a subject can access
+// via a permission, so callers (like the inventory API's listResourcesHandler)
+// can filter their own listings by SpiceDB permission instead of a raw
+// workspace_id column match.
+type LookupResourcesRequest struct {
+	ResourceType string `json:"resource_type"`
+	Permission   string `json:"permission"`
+	SubjectType  string `json:"subject_type"`
+	SubjectID    string `json:"subject_id"`
+}
+
+func lookupResourcesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LookupResourcesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.ResourceType == "" || req.Permission == "" {
+		http.Error(w, "resource_type and permission are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli, err := spicedbClient.LookupResources(ctx, &v1.LookupResourcesRequest{
+		Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		ResourceObjectType: req.ResourceType,
+		Permission:         req.Permission,
+		Subject: &v1.SubjectReference{
+			Object: &v1.ObjectReference{
+				ObjectType: req.SubjectType,
+				ObjectId:   req.SubjectID,
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to lookup resources: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to lookup resources: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var resourceIDs []string
+	for {
+		resp, err := cli.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to stream lookup results: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to stream lookup results: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if resp.Permissionship == v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION {
+			resourceIDs = append(resourceIDs, resp.ResourceObjectId)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"resource_ids": resourceIDs})
+}
@@ -0,0 +1,24 @@
+package main
+
+import "encoding/json"
+
+// jsonCodec lets the hand-maintained message types in
+// api/kessel/relations/v1 (plain structs, not yet wired up to
+// protoc-gen-go's reflection machinery) travel over the wire. It's
+// attached only to this package's gRPC server via grpc.ForceServerCodec
+// (which doesn't require a global encoding.RegisterCodec), so it never
+// shadows grpc-go's real "proto" codec for other gRPC clients sharing the
+// process (e.g. spicedbClient, dialed against embedded or external
+// SpiceDB). Once `make proto` generates real protobuf types this codec can
+// be dropped and the default binary codec takes back over transparently.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "kessel-json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
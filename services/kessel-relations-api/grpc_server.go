@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	relationsv1 "github.com/akoserwal/kessel-in-a-box/services/kessel-relations-api/api/kessel/relations/v1"
+)
+
+// relationsGRPCServer implements relationsv1.RelationsServiceServer on top of
+// the same spicedbClient the REST handlers use.
+type relationsGRPCServer struct {
+	relationsv1.RelationsServiceServer
+}
+
+func (s *relationsGRPCServer) WriteRelationships(ctx context.Context, req *relationsv1.WriteRelationshipsRequest) (*relationsv1.WriteRelationshipsResponse, error) {
+	if len(req.Updates) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "updates must not be empty")
+	}
+
+	updates := make([]*v1.RelationshipUpdate, 0, len(req.Updates))
+	for _, u := range req.Updates {
+		op, err := toSpiceDBOperation(u.Operation)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		updates = append(updates, &v1.RelationshipUpdate{
+			Operation:    op,
+			Relationship: toSpiceDBRelationship(u.Relationship),
+		})
+	}
+
+	resp, err := spicedbClient.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{Updates: updates})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to write relationships: %v", err)
+	}
+
+	return &relationsv1.WriteRelationshipsResponse{WrittenAt: resp.WrittenAt.String()}, nil
+}
+
+func (s *relationsGRPCServer) CheckPermission(ctx context.Context, req *relationsv1.CheckPermissionRequest) (*relationsv1.CheckPermissionResponse, error) {
+	resp, err := spicedbClient.CheckPermission(ctx, &v1.CheckPermissionRequest{
+		Resource:    toSpiceDBObjectRef(req.Resource),
+		Permission:  req.Permission,
+		Subject:     toSpiceDBSubjectRef(req.Subject),
+		Consistency: checkConsistency(req.AtLeastAsFreshZedToken),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check permission: %v", err)
+	}
+
+	return &relationsv1.CheckPermissionResponse{
+		Permissionship: relationsv1.Permissionship(resp.Permissionship),
+		CheckedAt:      resp.CheckedAt.String(),
+	}, nil
+}
+
+func (s *relationsGRPCServer) CheckBulkPermissions(ctx context.Context, req *relationsv1.CheckBulkPermissionsRequest) (*relationsv1.CheckBulkPermissionsResponse, error) {
+	if len(req.Items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "items must not be empty")
+	}
+
+	items := make([]*v1.CheckBulkPermissionsRequestItem, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, &v1.CheckBulkPermissionsRequestItem{
+			Resource:   toSpiceDBObjectRef(item.Resource),
+			Permission: item.Permission,
+			Subject:    toSpiceDBSubjectRef(item.Subject),
+		})
+	}
+
+	resp, err := spicedbClient.CheckBulkPermissions(ctx, &v1.CheckBulkPermissionsRequest{
+		Consistency: checkConsistency(req.AtLeastAsFreshZedToken),
+		Items:       items,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check bulk permissions: %v", err)
+	}
+
+	results := make([]*relationsv1.CheckBulkPermissionsResponseItem, len(resp.Pairs))
+	for i, pair := range resp.Pairs {
+		result := &relationsv1.CheckBulkPermissionsResponseItem{
+			Request: &relationsv1.CheckBulkPermissionsRequestItem{
+				Resource:   fromSpiceDBObjectRef(pair.Request.Resource),
+				Permission: pair.Request.Permission,
+				Subject:    fromSpiceDBSubjectRef(pair.Request.Subject),
+			},
+		}
+		switch outcome := pair.Response.(type) {
+		case *v1.CheckBulkPermissionsPair_Item:
+			result.Permissionship = relationsv1.Permissionship(outcome.Item.Permissionship)
+		case *v1.CheckBulkPermissionsPair_Error:
+			result.Error = outcome.Error.GetMessage()
+		}
+		results[i] = result
+	}
+
+	return &relationsv1.CheckBulkPermissionsResponse{
+		CheckedAt: resp.CheckedAt.String(),
+		Results:   results,
+	}, nil
+}
+
+func (s *relationsGRPCServer) ReadRelationships(req *relationsv1.ReadRelationshipsRequest, stream relationsv1.RelationsService_ReadRelationshipsServer) error {
+	filter := &v1.RelationshipFilter{}
+	if req.ResourceFilter != nil {
+		filter.ResourceType = req.ResourceFilter.ObjectType
+		filter.OptionalResourceId = req.ResourceFilter.ObjectId
+	}
+
+	cli, err := spicedbClient.ReadRelationships(stream.Context(), &v1.ReadRelationshipsRequest{
+		Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		RelationshipFilter: filter,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to read relationships: %v", err)
+	}
+
+	for {
+		resp, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return status.Errorf(codes.Internal, "stream read failed: %v", err)
+		}
+		if err := stream.Send(&relationsv1.ReadRelationshipsResponse{Relationship: fromSpiceDBRelationship(resp.Relationship)}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *relationsGRPCServer) LookupResources(req *relationsv1.LookupResourcesRequest, stream relationsv1.RelationsService_LookupResourcesServer) error {
+	cli, err := spicedbClient.LookupResources(stream.Context(), &v1.LookupResourcesRequest{
+		Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		ResourceObjectType: req.ResourceType,
+		Permission:         req.Permission,
+		Subject:            toSpiceDBSubjectRef(req.Subject),
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to lookup resources: %v", err)
+	}
+
+	for {
+		resp, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return status.Errorf(codes.Internal, "stream read failed: %v", err)
+		}
+		// SpiceDB's LookupPermissionship numbers its values differently from
+		// Permissionship (HAS_PERMISSION is 1 there, NO_PERMISSION here), so
+		// map by name rather than casting.
+		permissionship := relationsv1.PermissionshipUnspecified
+		if resp.Permissionship == v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION {
+			permissionship = relationsv1.PermissionshipHasPermission
+		}
+		if err := stream.Send(&relationsv1.LookupResourcesResponse{
+			ResourceId:     resp.ResourceObjectId,
+			Permissionship: permissionship,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func toSpiceDBOperation(op relationsv1.RelationshipUpdateOperation) (v1.RelationshipUpdate_Operation, error) {
+	switch op {
+	case relationsv1.OperationCreate:
+		return v1.RelationshipUpdate_OPERATION_CREATE, nil
+	case relationsv1.OperationTouch:
+		return v1.RelationshipUpdate_OPERATION_TOUCH, nil
+	case relationsv1.OperationDelete:
+		return v1.RelationshipUpdate_OPERATION_DELETE, nil
+	default:
+		return 0, fmt.Errorf("unknown relationship update operation: %v", op)
+	}
+}
+
+func toSpiceDBObjectRef(o *relationsv1.ObjectReference) *v1.ObjectReference {
+	if o == nil {
+		return nil
+	}
+	return &v1.ObjectReference{ObjectType: o.ObjectType, ObjectId: o.ObjectId}
+}
+
+func toSpiceDBSubjectRef(s *relationsv1.SubjectReference) *v1.SubjectReference {
+	if s == nil {
+		return nil
+	}
+	return &v1.SubjectReference{
+		Object:           toSpiceDBObjectRef(s.Object),
+		OptionalRelation: s.OptionalRelation,
+	}
+}
+
+func toSpiceDBRelationship(r *relationsv1.Relationship) *v1.Relationship {
+	if r == nil {
+		return nil
+	}
+	return &v1.Relationship{
+		Resource: toSpiceDBObjectRef(r.Resource),
+		Relation: r.Relation,
+		Subject:  toSpiceDBSubjectRef(r.Subject),
+	}
+}
+
+func fromSpiceDBObjectRef(o *v1.ObjectReference) *relationsv1.ObjectReference {
+	if o == nil {
+		return nil
+	}
+	return &relationsv1.ObjectReference{ObjectType: o.ObjectType, ObjectId: o.ObjectId}
+}
+
+func fromSpiceDBSubjectRef(s *v1.SubjectReference) *relationsv1.SubjectReference {
+	if s == nil {
+		return nil
+	}
+	return &relationsv1.SubjectReference{
+		Object:           fromSpiceDBObjectRef(s.Object),
+		OptionalRelation: s.OptionalRelation,
+	}
+}
+
+func fromSpiceDBRelationship(r *v1.Relationship) *relationsv1.Relationship {
+	if r == nil {
+		return nil
+	}
+	return &relationsv1.Relationship{
+		Resource: &relationsv1.ObjectReference{ObjectType: r.Resource.ObjectType, ObjectId: r.Resource.ObjectId},
+		Relation: r.Relation,
+		Subject: &relationsv1.SubjectReference{
+			Object:           &relationsv1.ObjectReference{ObjectType: r.Subject.Object.ObjectType, ObjectId: r.Subject.Object.ObjectId},
+			OptionalRelation: r.Subject.OptionalRelation,
+		},
+	}
+}
+
+// serveGRPCAndHTTP multiplexes gRPC and the existing HTTP/REST mux on a
+// single listener, routing by content-type the same way grpc-gateway
+// deployments typically share a port without a separate reverse proxy.
+func serveGRPCAndHTTP(addr string, grpcServer *grpc.Server, httpHandler http.Handler) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mixedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+
+	h2s := &http.Server{
+		Addr:    addr,
+		Handler: h2cHandler(mixedHandler),
+	}
+	return h2s.Serve(lis)
+}
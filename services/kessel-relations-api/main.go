@@ -10,14 +10,16 @@ import (
 	"time"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
-	"github.com/authzed/authzed-go/v1"
-	"github.com/authzed/grpcutil"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+
+	relationsv1 "github.com/akoserwal/kessel-in-a-box/services/kessel-relations-api/api/kessel/relations/v1"
 )
 
 var (
-	spicedbClient *authzed.Client
+	// spicedbClient only needs the PermissionsService surface; both a remote
+	// *authzed.Client and the in-process client dialed against an embedded
+	// SpiceDB satisfy it, so callers never branch on which mode is active.
+	spicedbClient v1.PermissionsServiceClient
 	serverPort    = getEnv("SERVER_PORT", "8000")
 )
 
@@ -29,35 +31,43 @@ func getEnv(key, fallback string) string {
 }
 
 func main() {
-	// Connect to SpiceDB
+	ctx := context.Background()
+
+	// Connect to SpiceDB. SPICEDB_ENDPOINT selects the mode:
+	//   embedded://[/path/to/schema.zed]  - boot an in-process SpiceDB
+	//   grpc://host:port or grpcs://host:port - dial an external SpiceDB
+	//   host:port (no scheme)             - dial an external SpiceDB (legacy default)
 	spicedbEndpoint := getEnv("SPICEDB_ENDPOINT", "localhost:50051")
 	spicedbToken := getEnv("SPICEDB_TOKEN", "testtesttesttest")
 
-	log.Printf("Connecting to SpiceDB at %s", spicedbEndpoint)
-
-	var err error
-	spicedbClient, err = authzed.NewClient(
-		spicedbEndpoint,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpcutil.WithInsecureBearerToken(spicedbToken),
-	)
+	closeSpiceDB, err := connectSpiceDB(ctx, spicedbEndpoint, spicedbToken)
 	if err != nil {
 		log.Fatalf("Failed to connect to SpiceDB: %v", err)
 	}
+	defer closeSpiceDB()
 
 	// Setup HTTP handlers
 	http.HandleFunc("/health", healthCheckHandler)
 	http.HandleFunc("/livez", healthCheckHandler)
 	http.HandleFunc("/readyz", readyCheckHandler)
 	http.HandleFunc("/v1/relationships", relationshipsHandler)
+	http.HandleFunc("/v1/relationships/read", relationshipsReadHandler)
 	http.HandleFunc("/v1/permissions/check", checkPermissionHandler)
+	http.HandleFunc("/v1/permissions/checkBulk", checkBulkPermissionsHandler)
+	http.HandleFunc("/v1/permissions/lookupResources", lookupResourcesHandler)
+
+	// gRPC server, sharing the same port as the REST handlers above. Forced
+	// onto this server only, so it doesn't affect other gRPC clients in the
+	// process (e.g. spicedbClient, dialed against embedded or external
+	// SpiceDB).
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	relationsv1.RegisterRelationsServiceServer(grpcServer, &relationsGRPCServer{})
 
-	// Start HTTP server
 	addr := ":" + serverPort
 	log.Printf("Starting kessel-relations-api (mock) on %s", addr)
-	log.Printf("Endpoints: /v1/relationships, /v1/permissions/check")
+	log.Printf("Endpoints: /v1/relationships, /v1/relationships/read, /v1/permissions/check, /v1/permissions/checkBulk, /v1/permissions/lookupResources (REST), kessel.relations.v1.RelationsService (gRPC)")
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	if err := serveGRPCAndHTTP(addr, grpcServer, http.DefaultServeMux); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -72,13 +82,18 @@ func readyCheckHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
 }
 
-// RelationshipRequest represents a request to create/update relationships
+// RelationshipRequest represents a request to create/update relationships.
+// It doubles as a single relationship (the original shape) and, via Updates,
+// a batch of them in one round-trip: bulk sync jobs set Updates and leave
+// the flat fields empty.
 type RelationshipRequest struct {
-	ResourceType string `json:"resource_type"`
-	ResourceID   string `json:"resource_id"`
-	Relation     string `json:"relation"`
-	SubjectType  string `json:"subject_type"`
-	SubjectID    string `json:"subject_id"`
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	Relation     string `json:"relation,omitempty"`
+	SubjectType  string `json:"subject_type,omitempty"`
+	SubjectID    string `json:"subject_id,omitempty"`
+
+	Updates []RelationshipUpdateItem `json:"updates,omitempty"`
 }
 
 func relationshipsHandler(w http.ResponseWriter, r *http.Request) {
@@ -93,45 +108,43 @@ func relationshipsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Creating relationship: %s:%s#%s@%s:%s",
-		req.ResourceType, req.ResourceID, req.Relation, req.SubjectType, req.SubjectID)
-
-	// Create relationship in SpiceDB
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	update := &v1.RelationshipUpdate{
-		Operation: v1.RelationshipUpdate_OPERATION_TOUCH,
-		Relationship: &v1.Relationship{
-			Resource: &v1.ObjectReference{
-				ObjectType: req.ResourceType,
-				ObjectId:   req.ResourceID,
-			},
-			Relation: req.Relation,
-			Subject: &v1.SubjectReference{
-				Object: &v1.ObjectReference{
-					ObjectType: req.SubjectType,
-					ObjectId:   req.SubjectID,
-				},
-			},
-		},
+	items := req.Updates
+	if len(items) == 0 {
+		items = []RelationshipUpdateItem{{
+			ResourceType: req.ResourceType,
+			ResourceID:   req.ResourceID,
+			Relation:     req.Relation,
+			SubjectType:  req.SubjectType,
+			SubjectID:    req.SubjectID,
+		}}
 	}
 
-	writeReq := &v1.WriteRelationshipsRequest{
-		Updates: []*v1.RelationshipUpdate{update},
+	updates := make([]*v1.RelationshipUpdate, 0, len(items))
+	for _, item := range items {
+		log.Printf("Writing relationship (%s): %s:%s#%s@%s:%s",
+			item.Operation, item.ResourceType, item.ResourceID, item.Relation, item.SubjectType, item.SubjectID)
+		update, err := item.toSpiceDBUpdate()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid update: %v", err), http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, update)
 	}
 
-	resp, err := spicedbClient.WriteRelationships(ctx, writeReq)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := spicedbClient.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{Updates: updates})
 	if err != nil {
-		log.Printf("Failed to write relationship: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to write relationship: %v", err), http.StatusInternalServerError)
+		log.Printf("Failed to write relationships: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to write relationships: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "created",
+		"status":     "created",
 		"written_at": resp.WrittenAt.String(),
 	})
 }
@@ -143,6 +156,11 @@ type CheckPermissionRequest struct {
 	Permission   string `json:"permission"`
 	SubjectType  string `json:"subject_type"`
 	SubjectID    string `json:"subject_id"`
+	// AtLeastAsFresh, if set, is a ZedToken previously returned by a write
+	// (e.g. the inventory row's stored zed_token). When present the check
+	// only needs to observe a revision at least that fresh instead of
+	// paying for FullyConsistent on every read.
+	AtLeastAsFresh string `json:"at_least_as_fresh,omitempty"`
 }
 
 func checkPermissionHandler(w http.ResponseWriter, r *http.Request) {
@@ -176,11 +194,7 @@ func checkPermissionHandler(w http.ResponseWriter, r *http.Request) {
 				ObjectId:   req.SubjectID,
 			},
 		},
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{
-				FullyConsistent: true,
-			},
-		},
+		Consistency: checkConsistency(req.AtLeastAsFresh),
 	})
 
 	if err != nil {
@@ -195,3 +209,17 @@ func checkPermissionHandler(w http.ResponseWriter, r *http.Request) {
 		"checked_at":     checkResp.CheckedAt.String(),
 	})
 }
+
+// checkConsistency builds a FullyConsistent requirement, unless a caller
+// supplies a zed token it has already observed, in which case AtLeastAsFresh
+// lets SpiceDB serve the check from a cached/replica revision.
+func checkConsistency(atLeastAsFresh string) *v1.Consistency {
+	if atLeastAsFresh == "" {
+		return &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}}
+	}
+	return &v1.Consistency{
+		Requirement: &v1.Consistency_AtLeastAsFresh{
+			AtLeastAsFresh: &v1.ZedToken{Token: atLeastAsFresh},
+		},
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/authzed-go/v1"
+	"github.com/authzed/grpcutil"
+	"github.com/authzed/spicedb/pkg/cmd/datastore"
+	"github.com/authzed/spicedb/pkg/cmd/server"
+	"github.com/authzed/spicedb/pkg/cmd/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// defaultSchema seeds an in-process SpiceDB with the same schema the
+// kessel-relations-api container otherwise expects an operator to load into
+// an external SpiceDB via `zed schema write`.
+//
+//go:embed schema/bootstrap.zed
+var defaultSchema []byte
+
+// connectSpiceDB resolves SPICEDB_ENDPOINT into a running spicedbClient.
+// embedded://[/path/to/schema.zed] boots an in-process SpiceDB; anything
+// else (grpc://host:port, grpcs://host:port, or a bare host:port) dials an
+// external one, exactly as before this was added. The returned func closes
+// the gRPC connection; an embedded server and its datastore keep running
+// until ctx is done.
+func connectSpiceDB(ctx context.Context, endpoint, token string) (func() error, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPICEDB_ENDPOINT %q: %w", endpoint, err)
+	}
+
+	if u.Scheme == "embedded" {
+		log.Printf("Booting embedded SpiceDB (engine=%s, schema=%s)", getEnv("SPICEDB_EMBEDDED_DATASTORE_ENGINE", datastore.MemoryEngine), u.Path)
+		conn, closer, err := startEmbeddedSpiceDB(ctx, getEnv("SPICEDB_EMBEDDED_DATASTORE_ENGINE", datastore.MemoryEngine), u.Path)
+		if err != nil {
+			return nil, err
+		}
+		spicedbClient = v1.NewPermissionsServiceClient(conn)
+
+		if seedPath := getEnv("SPICEDB_EMBEDDED_SEED_RELATIONSHIPS", ""); seedPath != "" {
+			if err := seedEmbeddedRelationships(ctx, seedPath); err != nil {
+				return nil, fmt.Errorf("failed to seed relationships from %s: %w", seedPath, err)
+			}
+		}
+		return closer, nil
+	}
+
+	remoteEndpoint := endpoint
+	if u.Scheme == "grpc" || u.Scheme == "grpcs" {
+		remoteEndpoint = u.Host
+	}
+
+	log.Printf("Connecting to SpiceDB at %s", remoteEndpoint)
+	dialOpts := []grpc.DialOption{grpcutil.WithInsecureBearerToken(token)}
+	if u.Scheme == "grpcs" {
+		creds, err := grpcutil.WithSystemCerts(grpcutil.VerifyCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system CA certs: %w", err)
+		}
+		dialOpts = append(dialOpts, creds)
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	client, err := authzed.NewClient(remoteEndpoint, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SpiceDB: %w", err)
+	}
+	spicedbClient = client
+	return client.Close, nil
+}
+
+// startEmbeddedSpiceDB boots an in-process SpiceDB (pkg/cmd/server) backed by
+// the given datastore engine ("memory" or "sqlite"), loading schemaPath (or
+// the bundled default schema when schemaPath is empty) on startup. It returns
+// a gRPC connection wired directly to the in-process server, the same way a
+// remote SPICEDB_ENDPOINT would return a connection to an external process.
+func startEmbeddedSpiceDB(ctx context.Context, engine, schemaPath string) (*grpc.ClientConn, func() error, error) {
+	if engine == "" {
+		engine = datastore.MemoryEngine
+	}
+
+	bootstrapOption := datastore.SetBootstrapFileContents(map[string][]byte{"bootstrap.zed": defaultSchema})
+	if schemaPath != "" {
+		bootstrapOption = datastore.SetBootstrapFiles([]string{schemaPath})
+	}
+
+	dsConfig := datastore.NewConfigWithOptionsAndDefaults().WithOptions(
+		datastore.WithEngine(engine),
+		bootstrapOption,
+		datastore.WithRequestHedgingEnabled(false),
+		datastore.WithGCWindow(24*time.Hour),
+	)
+
+	runnable, err := server.NewConfigWithOptionsAndDefaults(
+		server.WithGRPCServer(util.GRPCServerConfig{
+			Network: util.BufferedNetwork,
+			Enabled: true,
+		}),
+		server.WithDispatchServer(util.GRPCServerConfig{Enabled: false}),
+		server.WithDispatchUpstreamAddr(""),
+		server.WithHTTPGateway(util.HTTPServerConfig{HTTPEnabled: false}),
+		server.WithMetricsAPI(util.HTTPServerConfig{HTTPEnabled: false}),
+		server.WithSilentlyDisableTelemetry(true),
+		server.WithDispatchClusterMetricsEnabled(false),
+		server.WithDispatchClientMetricsEnabled(false),
+		server.WithDispatchCacheConfig(server.CacheConfig{Enabled: false}),
+		server.WithNamespaceCacheConfig(server.CacheConfig{Enabled: false}),
+		server.WithClusterDispatchCacheConfig(server.CacheConfig{Enabled: false}),
+		server.WithDatastoreConfig(*dsConfig),
+		server.WithGRPCAuthFunc(func(ctx context.Context) (context.Context, error) { return ctx, nil }),
+	).Complete(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to complete embedded SpiceDB config: %w", err)
+	}
+
+	go func() {
+		if err := runnable.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Fatalf("Embedded SpiceDB server stopped unexpectedly: %v", err)
+		}
+	}()
+
+	conn, err := runnable.NewClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial embedded SpiceDB: %w", err)
+	}
+
+	return conn, conn.Close, nil
+}
+
+// seedEmbeddedRelationships pre-populates a freshly booted embedded SpiceDB
+// with relationships from a JSON file, so a dev/test environment doesn't
+// have to replay a full sync job just to have data to check permissions
+// against. The file holds the same []RelationshipUpdateItem shape the
+// /v1/relationships batch endpoint accepts.
+func seedEmbeddedRelationships(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var items []RelationshipUpdateItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("invalid seed relationships file: %w", err)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	updates := make([]*v1.RelationshipUpdate, 0, len(items))
+	for _, item := range items {
+		update, err := item.toSpiceDBUpdate()
+		if err != nil {
+			return fmt.Errorf("invalid seed relationship %s:%s#%s@%s:%s: %w",
+				item.ResourceType, item.ResourceID, item.Relation, item.SubjectType, item.SubjectID, err)
+		}
+		updates = append(updates, update)
+	}
+
+	if _, err := spicedbClient.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{Updates: updates}); err != nil {
+		return err
+	}
+	log.Printf("Seeded %d relationship(s) from %s", len(updates), path)
+	return nil
+}